@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/scanner"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vkd/golime/tools"
+)
+
+// Codes of Error
+const (
+	ErrCodeUnknownCommand = "unknown_command"
+	ErrCodeBadRequest     = "bad_request"
+	ErrCodeParseError     = "parse_error"
+	ErrCodeNotFound       = "not_found"
+	ErrCodeConflict       = "conflict"
+	ErrCodeCancelled      = "cancelled"
+	ErrCodeTimeout        = "timeout"
+	ErrCodeForbidden      = "forbidden"
+	ErrCodeNotAllowed     = "method_not_allowed"
+	ErrCodeInternal       = "internal"
+)
+
+// Error - error of command, it is returned in the same way by CLI and server:
+//
+//	{"error": {"code": "parse_error", "message": "...", "file": "main.go", "line": 3, "column": 1, "causes": [...]}}
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// File, Line, Column - position of parse error
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+
+	// Causes - messages of wrapped errors from outer to the root cause
+	Causes []string `json:"causes,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorResult - body of error response
+type ErrorResult struct {
+	Error *Error `json:"error"`
+}
+
+// newError - Error with code detected by root cause of err
+func newError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+
+	e := &Error{
+		Code:    ErrCodeInternal,
+		Message: err.Error(),
+		Causes:  causeChain(err),
+	}
+
+	switch cause := errors.Cause(err).(type) {
+	case *Error:
+		e.Code = cause.Code
+		e.File, e.Line, e.Column = cause.File, cause.Line, cause.Column
+	case scanner.ErrorList:
+		e.Code = ErrCodeParseError
+		if len(cause) > 0 {
+			e.File = cause[0].Pos.Filename
+			e.Line = cause[0].Pos.Line
+			e.Column = cause[0].Pos.Column
+		}
+	case *scanner.Error:
+		e.Code = ErrCodeParseError
+		e.File, e.Line, e.Column = cause.Pos.Filename, cause.Pos.Line, cause.Pos.Column
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		e.Code = ErrCodeBadRequest
+	case *tools.ImportConflictError:
+		e.Code = ErrCodeConflict
+	default:
+		switch {
+		case cause == context.Canceled:
+			e.Code = ErrCodeCancelled
+		case cause == context.DeadlineExceeded:
+			e.Code = ErrCodeTimeout
+		case os.IsNotExist(cause):
+			e.Code = ErrCodeNotFound
+		}
+	}
+	return e
+}
+
+// causeChain - messages of each wrap of err
+// For errors.Wrap(errors.Wrap(io.EOF, "b"), "a") it is ["a", "b", "EOF"].
+func causeChain(err error) []string {
+	type causer interface {
+		Cause() error
+	}
+
+	var chain []string
+	for err != nil {
+		c, ok := err.(causer)
+		if !ok {
+			chain = append(chain, err.Error())
+			break
+		}
+		next := c.Cause()
+		if next == nil {
+			chain = append(chain, err.Error())
+			break
+		}
+		// errors.WithStack keeps message of cause, skip it
+		if msg := err.Error(); msg != next.Error() {
+			chain = append(chain, strings.TrimSuffix(msg, ": "+next.Error()))
+		}
+		err = next
+	}
+	return chain
+}
+
+func errUnknownCommand(cmd string) *Error {
+	return &Error{Code: ErrCodeUnknownCommand, Message: fmt.Sprintf("unknown command: %q", cmd)}
+}
+
+// errBadRequest - copy of Error of err with code of bad request,
+// *Error passed as err is not changed
+func errBadRequest(err error) *Error {
+	e := *newError(err)
+	e.Code = ErrCodeBadRequest
+	return &e
+}
+
+// httpStatus - status of HTTP response for error code
+func (e *Error) httpStatus() int {
+	switch e.Code {
+	case ErrCodeUnknownCommand, ErrCodeBadRequest:
+		return http.StatusBadRequest
+	case ErrCodeNotFound:
+		return http.StatusNotFound
+	case ErrCodeConflict:
+		return http.StatusConflict
+	case ErrCodeParseError:
+		return http.StatusUnprocessableEntity
+	case ErrCodeTimeout:
+		return http.StatusGatewayTimeout
+	case ErrCodeForbidden:
+		return http.StatusForbidden
+	case ErrCodeNotAllowed:
+		return http.StatusMethodNotAllowed
+	}
+	return http.StatusInternalServerError
+}
+
+// rpcCode - code of JSON-RPC error for error code
+func (e *Error) rpcCode() int {
+	switch e.Code {
+	case ErrCodeUnknownCommand:
+		return rpcMethodNotFound
+	case ErrCodeBadRequest:
+		return rpcInvalidParams
+	case ErrCodeCancelled:
+		return rpcRequestCancelled
+	}
+	return rpcInternalError
+}
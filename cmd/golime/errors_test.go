@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewError(t *testing.T) {
+	_, parseErr := parser.ParseFile(token.NewFileSet(), "main.go", "package main\n\nfunc {", 0)
+	jsonErr := json.Unmarshal([]byte("{"), &struct{}{})
+	_, notExist := os.Open("not_exist.go")
+	wrapped := &Error{Code: ErrCodeConflict, Message: "conflict", File: "a.go", Line: 1, Column: 2}
+
+	tests := []struct {
+		name   string
+		err    error
+		expect Error
+	}{
+		{
+			name:   "parse error",
+			err:    errors.Wrap(parseErr, "error on parse file"),
+			expect: Error{Code: ErrCodeParseError, File: "main.go", Line: 3, Column: 6},
+		},
+		{
+			name:   "json",
+			err:    errors.Wrap(jsonErr, "error on unmarshal data"),
+			expect: Error{Code: ErrCodeBadRequest},
+		},
+		{
+			name:   "not found",
+			err:    errors.Wrap(notExist, "error on read file"),
+			expect: Error{Code: ErrCodeNotFound},
+		},
+		{
+			name:   "cancelled",
+			err:    errors.Wrap(context.Canceled, "command is stopped"),
+			expect: Error{Code: ErrCodeCancelled},
+		},
+		{
+			name:   "timeout",
+			err:    errors.Wrap(context.DeadlineExceeded, "command is stopped"),
+			expect: Error{Code: ErrCodeTimeout},
+		},
+		{
+			name:   "wrapped Error",
+			err:    errors.Wrap(wrapped, "error on add import"),
+			expect: Error{Code: ErrCodeConflict, File: "a.go", Line: 1, Column: 2},
+		},
+		{
+			name:   "internal",
+			err:    errors.New("unexpected"),
+			expect: Error{Code: ErrCodeInternal},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newError(tt.err)
+			got := Error{Code: e.Code, File: e.File, Line: e.Line, Column: e.Column}
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("Wrong error: %+v, expected %+v", got, tt.expect)
+			}
+			if e.Message != tt.err.Error() {
+				t.Errorf("Wrong message: %q", e.Message)
+			}
+		})
+	}
+}
+
+func TestErrBadRequest(t *testing.T) {
+	e := &Error{Code: ErrCodeNotFound, Message: "not found"}
+	bad := errBadRequest(e)
+	if bad.Code != ErrCodeBadRequest || bad.Message != e.Message {
+		t.Errorf("Wrong error: %+v", bad)
+	}
+	if e.Code != ErrCodeNotFound {
+		t.Errorf("Original error is changed: %+v", e)
+	}
+}
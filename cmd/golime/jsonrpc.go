@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+
+	// rpcRequestCancelled - code of LSP for cancelled requests
+	rpcRequestCancelled = -32800
+)
+
+// rpcCancelMethod - notification to cancel request by id (as in LSP)
+const rpcCancelMethod = "$/cancelRequest"
+
+type rpcCancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// rpcIDKey - request id as string to use in CmdArgs.ID
+// Raw JSON is used, so number 1 and string "1" are different ids.
+func rpcIDKey(id json.RawMessage) string {
+	var b bytes.Buffer
+	if json.Compact(&b, id) != nil {
+		return string(id)
+	}
+	return b.String()
+}
+
+// rpcMessage - incoming JSON-RPC message: request, notification or response
+type rpcMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+// isNotification - message has a method, but server must not answer on it
+func (m *rpcMessage) isNotification() bool {
+	return m.ID == nil
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+type rpcResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// rpcConn - JSON-RPC connection
+// Messages are framed with Content-Length header (as in LSP)
+// or by newlines. Framing is detected on the first message
+// and used for all messages sent back.
+type rpcConn struct {
+	r *bufio.Reader
+
+	// detected - framing is detected, it is used only by Read
+	detected bool
+	// resync - header was malformed, Read skips lines up to the next header
+	resync bool
+
+	mu          sync.Mutex
+	w           io.Writer
+	lastID      int64
+	lineFraming bool
+}
+
+func newRPCConn(r io.Reader, w io.Writer) *rpcConn {
+	return &rpcConn{r: bufio.NewReader(r), w: w}
+}
+
+// Read - read next message from connection
+// Malformed message is skipped and *rpcError is returned,
+// it is answered with null id and connection is served further.
+func (c *rpcConn) Read() (*rpcMessage, error) {
+	err := c.detectFraming()
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if c.lineFraming {
+		body, err = c.readLine()
+	} else {
+		body, err = c.readContentLength()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bs := bytes.TrimSpace(body); len(bs) > 0 && bs[0] == '[' {
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "batch requests are not supported"}
+	}
+
+	var msg rpcMessage
+	err = json.Unmarshal(body, &msg)
+	if err != nil {
+		return nil, &rpcError{Code: rpcParseError, Message: err.Error()}
+	}
+	return &msg, nil
+}
+
+// detectFraming - skip blank lines and check whether the first message starts with JSON
+func (c *rpcConn) detectFraming() error {
+	if c.detected {
+		return nil
+	}
+	for {
+		b, err := c.r.Peek(1)
+		if err != nil {
+			return err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			c.r.ReadByte() // nolint: errcheck
+			continue
+		}
+
+		c.mu.Lock()
+		c.lineFraming = b[0] == '{' || b[0] == '['
+		c.mu.Unlock()
+		c.detected = true
+		return nil
+	}
+}
+
+// readLine - next non-blank line without surrounding spaces
+func (c *rpcConn) readLine() ([]byte, error) {
+	for {
+		line, err := c.r.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && (err == nil || err == io.EOF) {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readContentLength - body of message framed by Content-Length header
+// Malformed header is returned as parse error and lines are skipped
+// up to the next Content-Length header, so session is not broken.
+func (c *rpcConn) readContentLength() ([]byte, error) {
+	length := -1
+	var started, malformed bool
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF && (!started || c.resync) {
+				return nil, io.EOF
+			}
+			return nil, errors.Wrap(err, "error on read header")
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if c.resync {
+			// body of malformed message may precede the next header in the same line
+			i := strings.Index(strings.ToLower(line), "content-length:")
+			if i < 0 {
+				continue
+			}
+			line = line[i:]
+			c.resync = false
+		}
+		if line == "" {
+			if !started {
+				continue
+			}
+			break
+		}
+		started = true
+
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			malformed = true
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(line[:i]), "Content-Length") {
+			n, err := strconv.Atoi(strings.TrimSpace(line[i+1:]))
+			if err != nil || n < 0 {
+				malformed = true
+				continue
+			}
+			length = n
+		}
+	}
+	if malformed || length < 0 {
+		c.resync = true
+		return nil, &rpcError{Code: rpcParseError, Message: "malformed header: valid Content-Length is expected"}
+	}
+
+	body := make([]byte, length)
+	_, err := io.ReadFull(c.r, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read message body")
+	}
+	return body, nil
+}
+
+// Reply - send result or error on request with id
+func (c *rpcConn) Reply(id *json.RawMessage, result interface{}, err error) error {
+	resp := rpcResponse{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		rerr, ok := errors.Cause(err).(*rpcError)
+		if !ok {
+			e := newError(err)
+			rerr = &rpcError{Code: e.rpcCode(), Message: e.Message, Data: e}
+		}
+		resp.Error = rerr
+	} else {
+		bs, err := json.Marshal(result)
+		if err != nil {
+			return errors.Wrap(err, "error on marshal result")
+		}
+		resp.Result = bs
+	}
+	return c.write(resp)
+}
+
+// Notify - send notification to other side
+func (c *rpcConn) Notify(method string, params interface{}) error {
+	return c.write(rpcRequest{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Call - send request to other side
+// response is not waited, it comes as regular message into Read
+func (c *rpcConn) Call(method string, params interface{}) error {
+	c.mu.Lock()
+	c.lastID++
+	id := c.lastID
+	c.mu.Unlock()
+	return c.write(rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+}
+
+func (c *rpcConn) write(msg interface{}) error {
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "error on marshal message")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lineFraming {
+		_, err = fmt.Fprintf(c.w, "%s\n", bs)
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(bs), bs)
+	return err
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/vkd/golime/tools"
+)
+
+// lsp* - minimal subset of Language Server Protocol types used by golime
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspWorkspaceEdit struct {
+	Changes         map[string][]lspTextEdit `json:"changes,omitempty"`
+	DocumentChanges []interface{}            `json:"documentChanges,omitempty"`
+}
+
+type lspCommand struct {
+	Title     string        `json:"title"`
+	Command   string        `json:"command"`
+	Arguments []interface{} `json:"arguments,omitempty"`
+}
+
+type lspCodeAction struct {
+	Title   string            `json:"title"`
+	Kind    string            `json:"kind,omitempty"`
+	Edit    *lspWorkspaceEdit `json:"edit,omitempty"`
+	Command *lspCommand       `json:"command,omitempty"`
+}
+
+type lspCompletionItem struct {
+	Label      string `json:"label"`
+	Kind       int    `json:"kind"`
+	SortText   string `json:"sortText,omitempty"`
+	FilterText string `json:"filterText,omitempty"`
+}
+
+type lspCompletionList struct {
+	IsIncomplete bool                `json:"isIncomplete"`
+	Items        []lspCompletionItem `json:"items"`
+}
+
+type lspTextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type lspTextDocumentPositionParams struct {
+	TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+	Position     lspPosition               `json:"position"`
+}
+
+type lspCodeActionParams struct {
+	TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+	Range        lspRange                  `json:"range"`
+}
+
+type lspExecuteCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments"`
+}
+
+type lspDidOpenParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+}
+
+type lspDidChangeParams struct {
+	TextDocument   lspTextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+const (
+	lspCompletionKindModule = 9
+	lspCompletionLimit      = 100
+
+	lspCommandPrefix = "golime."
+)
+
+// lspCommands - commands exposed through workspace/executeCommand
+var lspCommands = []string{
+	lspCommandPrefix + "add_import",
+	lspCommandPrefix + "add_comments",
+	lspCommandPrefix + "organize_imports",
+	lspCommandPrefix + "gotest",
+}
+
+// lspTimeouts - timeouts of LSP requests which differ from defaultCmdTimeout
+var lspTimeouts = map[string]time.Duration{
+	"textDocument/completion":  cmdTimeouts["imports"],
+	"workspace/executeCommand": cmdTimeouts["gotest"],
+}
+
+// lspServer - Language Server Protocol front end over golime commands
+type lspServer struct {
+	conn *rpcConn
+
+	// opened documents are kept in tools.DefaultOverlay
+
+	// isShutdown - shutdown request is received, only exit is expected
+	isShutdown bool
+}
+
+func runLSP(r io.Reader, w io.Writer) error {
+	s := &lspServer{
+		conn: newRPCConn(r, w),
+	}
+	// wait responses on requests in progress
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		msg, err := s.conn.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if rerr, ok := err.(*rpcError); ok {
+				s.conn.Reply(nil, nil, rerr) // nolint: errcheck
+				continue
+			}
+			return errors.Wrap(err, "error on read message")
+		}
+		if msg.Method == "" {
+			// response on our request (e.g. workspace/applyEdit) has result or error
+			if msg.ID != nil && msg.Result == nil && msg.Error == nil {
+				s.conn.Reply(msg.ID, nil, &rpcError{Code: rpcInvalidRequest, Message: "method is expected"}) // nolint: errcheck
+			}
+			continue
+		}
+		switch {
+		case msg.Method == "exit":
+			return nil
+		case s.isShutdown:
+			// notifications are dropped, requests are invalid after shutdown
+			if !msg.isNotification() {
+				s.conn.Reply(msg.ID, nil, &rpcError{Code: rpcInvalidRequest, Message: "server is shut down"}) // nolint: errcheck
+			}
+			continue
+		case msg.Method == rpcCancelMethod:
+			var p rpcCancelParams
+			if json.Unmarshal(msg.Params, &p) == nil {
+				running.Cancel(lspRequestKey(p.ID))
+			}
+			continue
+		case msg.Method == "shutdown" && !msg.isNotification():
+			// it is handled in order, so next requests are rejected
+			s.isShutdown = true
+			s.conn.Reply(msg.ID, nil, nil) // nolint: errcheck
+			continue
+		}
+
+		if msg.isNotification() {
+			// notifications change state of documents, so keep their order
+			s.handle(context.Background(), msg) // nolint: errcheck
+			continue
+		}
+
+		wg.Add(1)
+		go func(msg *rpcMessage) {
+			defer wg.Done()
+			timeout := defaultCmdTimeout
+			if t, ok := lspTimeouts[msg.Method]; ok {
+				timeout = t
+			}
+			ctx, done := running.Start(context.Background(), lspRequestKey(*msg.ID), timeout)
+			defer done()
+
+			res, err := s.handle(ctx, msg)
+			if err == nil && ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			err = s.conn.Reply(msg.ID, res, err)
+			if err != nil {
+				log.Printf("Error on write response: %v", err)
+			}
+		}(msg)
+	}
+}
+
+// lspRequestKey - key of LSP request in running requests
+func lspRequestKey(id json.RawMessage) string {
+	return "lsp:" + rpcIDKey(id)
+}
+
+func (s *lspServer) handle(ctx context.Context, msg *rpcMessage) (interface{}, error) {
+	switch msg.Method {
+	case "initialize":
+		return Result{
+			"capabilities": Result{
+				"textDocumentSync":   1, // full
+				"codeActionProvider": true,
+				"completionProvider": Result{"triggerCharacters": []string{"\"", "/"}},
+				"executeCommandProvider": Result{
+					"commands": lspCommands,
+				},
+			},
+			"serverInfo": Result{"name": "golime", "version": version},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p lspDidOpenParams
+		if err := unmarshalParams(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.setDoc(p.TextDocument.URI, []byte(p.TextDocument.Text))
+	case "textDocument/didChange":
+		var p lspDidChangeParams
+		if err := unmarshalParams(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.ContentChanges) > 0 {
+			return nil, s.setDoc(p.TextDocument.URI, []byte(p.ContentChanges[len(p.ContentChanges)-1].Text))
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p struct {
+			TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+		}
+		if err := unmarshalParams(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		filename, err := uriToFilename(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		tools.DefaultOverlay.Delete(filename)
+		return nil, nil
+	case "textDocument/completion":
+		var p lspTextDocumentPositionParams
+		if err := unmarshalParams(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.completion(ctx, p)
+	case "textDocument/codeAction":
+		var p lspCodeActionParams
+		if err := unmarshalParams(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.codeActions(p)
+	case "workspace/executeCommand":
+		var p lspExecuteCommandParams
+		if err := unmarshalParams(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.executeCommand(ctx, p)
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func unmarshalParams(params json.RawMessage, v interface{}) error {
+	err := json.Unmarshal(params, v)
+	if err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *lspServer) setDoc(uri string, text []byte) error {
+	filename, err := uriToFilename(uri)
+	if err != nil {
+		return err
+	}
+	tools.DefaultOverlay.Set(filename, text)
+	return nil
+}
+
+// content - text of document: opened version or file on disk
+func (s *lspServer) content(uri string) ([]byte, error) {
+	filename, err := uriToFilename(uri)
+	if err != nil {
+		return nil, err
+	}
+	return tools.ReadFile(filename, nil)
+}
+
+func (s *lspServer) completion(ctx context.Context, p lspTextDocumentPositionParams) (interface{}, error) {
+	text, err := s.content(p.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read document")
+	}
+	prefix, ok := importPrefixAt(text, p.Position)
+	if !ok {
+		return []lspCompletionItem{}, nil
+	}
+
+	filename, err := uriToFilename(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := importIndex().Search(ctx, filepath.Dir(filename), prefix, lspCompletionLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on get import paths")
+	}
+
+	items := make([]lspCompletionItem, len(candidates))
+	for i, c := range candidates {
+		items[i] = lspCompletionItem{
+			Label:      c.Path,
+			Kind:       lspCompletionKindModule,
+			SortText:   fmt.Sprintf("%05d", i),
+			FilterText: prefix,
+		}
+	}
+	// list is cut by limit, so client has to ask again on next typed char
+	return lspCompletionList{IsIncomplete: len(items) == lspCompletionLimit, Items: items}, nil
+}
+
+var importLineRgx = regexp.MustCompile(`^\s*(import\s+)?([\w.]+\s+)?"([^"]*)$`)
+
+// importPrefixAt - typed part of import path if pos is inside of import string
+func importPrefixAt(text []byte, pos lspPosition) (string, bool) {
+	lines := strings.Split(string(text), "\n")
+	if pos.Line >= len(lines) {
+		return "", false
+	}
+	line := lines[pos.Line]
+	line = line[:positionToLineOffset(line, pos.Character)]
+
+	m := importLineRgx.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	if m[1] != "" {
+		return m[3], true
+	}
+
+	// inside of `import (...)` block
+	for i := pos.Line - 1; i >= 0; i-- {
+		l := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(l, "import"):
+			return m[3], strings.HasSuffix(l, "(")
+		case strings.HasPrefix(l, ")"), strings.HasPrefix(l, "func"),
+			strings.HasPrefix(l, "type"), strings.HasPrefix(l, "var"), strings.HasPrefix(l, "const"):
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func (s *lspServer) codeActions(p lspCodeActionParams) (interface{}, error) {
+	filename, err := uriToFilename(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []lspCodeAction{}
+
+	// e.g. document has syntax error, other actions are still available
+	edit, err := s.addCommentsEdit(filename)
+	if err != nil {
+		log.Printf("Error on add comments action: %v", err)
+	} else if len(edit.Changes) > 0 {
+		actions = append(actions, lspCodeAction{
+			Title: "Add missing doc comments",
+			Kind:  "source",
+			Edit:  edit,
+		})
+	}
+
+	// missing imports are resolved on execute, it may be slow
+	actions = append(actions, lspCodeAction{
+		Title: "Organize imports",
+		Kind:  "source.organizeImports",
+		Command: &lspCommand{
+			Title:     "Organize imports",
+			Command:   lspCommandPrefix + "organize_imports",
+			Arguments: []interface{}{Result{"file": filename}},
+		},
+	})
+
+	text, err := s.content(p.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read document")
+	}
+	if fn := funcNameAt(filename, text, p.Range.Start); fn != "" && !strings.HasSuffix(filename, "_test.go") {
+		actions = append(actions, lspCodeAction{
+			Title: "Generate test for " + fn,
+			Kind:  "source",
+			Command: &lspCommand{
+				Title:     "Generate test for " + fn,
+				Command:   lspCommandPrefix + "gotest",
+				Arguments: []interface{}{Result{"file": filename, "function": fn}},
+			},
+		})
+	}
+	return actions, nil
+}
+
+// funcNameAt - name of function declaration which contains pos
+func funcNameAt(filename string, text []byte, pos lspPosition) string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, text, 0)
+	if file == nil && err != nil {
+		return ""
+	}
+	line := pos.Line + 1
+	for _, d := range file.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok {
+			if fset.Position(fd.Pos()).Line <= line && line <= fset.Position(fd.End()).Line {
+				return fd.Name.Name
+			}
+		}
+	}
+	return ""
+}
+
+func (s *lspServer) executeCommand(ctx context.Context, p lspExecuteCommandParams) (interface{}, error) {
+	if !strings.HasPrefix(p.Command, lspCommandPrefix) {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "unknown command: " + p.Command}
+	}
+	name := strings.TrimPrefix(p.Command, lspCommandPrefix)
+
+	var data json.RawMessage
+	if len(p.Arguments) > 0 {
+		data = p.Arguments[0]
+	}
+	data, err := lspCommandData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := running.Run(ctx, CmdArgs{Cmd: name, Data: data})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error on run command %q", name)
+	}
+	res, ok := out.(Result)
+	if !ok {
+		return out, nil
+	}
+	edits, ok := res["result"].([]tools.TextEdit)
+	if !ok {
+		return out, nil
+	}
+
+	edit, err := newWorkspaceEdit(edits)
+	if err != nil {
+		return nil, err
+	}
+	err = s.conn.Call("workspace/applyEdit", Result{"label": p.Command, "edit": edit})
+	if err != nil {
+		return nil, errors.Wrap(err, "error on send workspace/applyEdit")
+	}
+	return nil, nil
+}
+
+// lspCommandData - data of command with offsets of edits in UTF-16 code units
+// as positions of LSP are, encoding of client is replaced
+func lspCommandData(data json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &fields)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+	}
+	if fields == nil {
+		fields = make(map[string]json.RawMessage)
+	}
+	fields["encoding"] = json.RawMessage(strconv.Quote(string(tools.EncodingUTF16)))
+	delete(fields, "isRuneCount")
+	bs, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on marshal data")
+	}
+	return bs, nil
+}
+
+func (s *lspServer) addCommentsEdit(filename string) (*lspWorkspaceEdit, error) {
+	edits, err := tools.AddComments(filename, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on add comments")
+	}
+	src, err := tools.ReadFile(filename, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read file")
+	}
+	err = tools.EncodeOffsets(edits, src, tools.EncodingUTF16)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on encode offsets")
+	}
+	return newWorkspaceEdit(edits)
+}
+
+// newWorkspaceEdit - convert edits with offsets in UTF-16 code units into LSP edit
+// Edits of not existing files are made as creation of file.
+func newWorkspaceEdit(edits []tools.TextEdit) (*lspWorkspaceEdit, error) {
+	var files []string
+	byFile := make(map[string][]tools.TextEdit)
+	for _, e := range edits {
+		if _, ok := byFile[e.File]; !ok {
+			files = append(files, e.File)
+		}
+		byFile[e.File] = append(byFile[e.File], e)
+	}
+
+	out := &lspWorkspaceEdit{Changes: map[string][]lspTextEdit{}}
+	var created bool
+	for _, filename := range files {
+		text, err := tools.ReadFile(filename, nil)
+		isNew := os.IsNotExist(err)
+		if err != nil && !isNew {
+			return nil, errors.Wrap(err, "error on read file")
+		}
+		uri := filenameToURI(filename)
+		lspEdits := []lspTextEdit{}
+		for _, e := range byFile[filename] {
+			lspEdits = append(lspEdits, lspTextEdit{
+				Range: lspRange{
+					Start: offsetToPosition(text, e.Start),
+					End:   offsetToPosition(text, e.End),
+				},
+				NewText: e.NewText,
+			})
+		}
+		out.Changes[uri] = lspEdits
+
+		if isNew {
+			created = true
+			out.DocumentChanges = append(out.DocumentChanges, Result{"kind": "create", "uri": uri})
+		}
+		out.DocumentChanges = append(out.DocumentChanges, Result{
+			"textDocument": Result{"uri": uri, "version": nil},
+			"edits":        lspEdits,
+		})
+	}
+
+	// clients prefer documentChanges, they are needed only to create files
+	if !created {
+		out.DocumentChanges = nil
+	} else {
+		out.Changes = nil
+	}
+	return out, nil
+}
+
+// offsetToPosition - offset in UTF-16 code units to LSP line and UTF-16 character
+func offsetToPosition(text []byte, offset int) lspPosition {
+	var pos lspPosition
+	for n := 0; n < offset && len(text) > 0; {
+		r, size := utf8.DecodeRune(text)
+		text = text[size:]
+		units := len(utf16.Encode([]rune{r}))
+		n += units
+		if r == '\n' {
+			pos.Line++
+			pos.Character = 0
+			continue
+		}
+		pos.Character += units
+	}
+	return pos
+}
+
+// positionToLineOffset - UTF-16 character on line to byte offset
+func positionToLineOffset(line string, character int) int {
+	var n int
+	for i, r := range line {
+		if n >= character {
+			return i
+		}
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return len(line)
+}
+
+func uriToFilename(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", errors.Wrap(err, "error on parse uri")
+	}
+	if u.Scheme != "file" {
+		return "", errors.Errorf("unsupported uri scheme: %q", u.Scheme)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+func filenameToURI(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err == nil {
+		filename = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
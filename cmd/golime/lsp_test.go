@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rpcInput - messages framed by Content-Length headers or by newlines
+func rpcInput(lineFraming bool, msgs ...string) *bytes.Buffer {
+	var b bytes.Buffer
+	for _, m := range msgs {
+		if lineFraming {
+			fmt.Fprintf(&b, "%s\n", m)
+			continue
+		}
+		fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return &b
+}
+
+// rpcMessages - all messages written by server
+func rpcMessages(t *testing.T, out *bytes.Buffer) []*rpcMessage {
+	var msgs []*rpcMessage
+	conn := newRPCConn(out, ioutil.Discard)
+	for {
+		msg, err := conn.Read()
+		if err == io.EOF {
+			return msgs
+		}
+		if err != nil {
+			t.Fatalf("Error on read output: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// rpcOutput - responses by id and requests written by server
+func rpcOutput(t *testing.T, out *bytes.Buffer) (map[string]*rpcMessage, []*rpcMessage) {
+	replies := make(map[string]*rpcMessage)
+	var requests []*rpcMessage
+	for _, msg := range rpcMessages(t, out) {
+		switch {
+		case msg.Method != "":
+			requests = append(requests, msg)
+		case msg.ID != nil:
+			replies[string(*msg.ID)] = msg
+		default:
+			replies["null"] = msg
+		}
+	}
+	return replies, requests
+}
+
+// checkReply - reply on id has result if code is 0 or error with code
+func checkReply(t *testing.T, replies map[string]*rpcMessage, id string, code int) *rpcMessage {
+	t.Helper()
+	r, ok := replies[id]
+	switch {
+	case !ok:
+		t.Errorf("No reply on %s", id)
+	case code == 0 && r.Error != nil:
+		t.Errorf("Unexpected error on %s: %v", id, r.Error)
+	case code != 0 && (r.Error == nil || r.Error.Code != code):
+		t.Errorf("Wrong error on %s: %v, expected code %d", id, r.Error, code)
+	}
+	return r
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	filename := filepath.Join(dir, name)
+	err := ioutil.WriteFile(filename, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("Error on write file: %v", err)
+	}
+	return filename
+}
+
+func TestLSP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golime")
+	if err != nil {
+		t.Fatalf("Error on create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	broken := filenameToURI(writeTestFile(t, dir, "broken.go", "package p\n\nfunc F( {\n"))
+	// offset of func in UTF-16 differs from byte one
+	file := writeTestFile(t, dir, "p.go", "package p\n\nvar s = \"日本\"; func F() {}\n")
+
+	tests := []struct {
+		name  string
+		msgs  []string
+		check func(t *testing.T, replies map[string]*rpcMessage, requests []*rpcMessage)
+	}{
+		{
+			name: "initialize and shutdown",
+			msgs: []string{
+				`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+				`{"jsonrpc":"2.0","id":2,"method":"unknown/method"}`,
+				`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`,
+				`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///x.go","text":"x"}}}`,
+				`{"jsonrpc":"2.0","id":4,"method":"textDocument/codeAction","params":{}}`,
+				`{"jsonrpc":"2.0","method":"exit"}`,
+				`{"jsonrpc":"2.0","id":5,"method":"initialize","params":{}}`,
+			},
+			check: func(t *testing.T, replies map[string]*rpcMessage, requests []*rpcMessage) {
+				r := checkReply(t, replies, "1", 0)
+				var res struct {
+					Capabilities struct {
+						CodeActionProvider bool `json:"codeActionProvider"`
+					} `json:"capabilities"`
+				}
+				if r != nil && (json.Unmarshal(r.Result, &res) != nil || !res.Capabilities.CodeActionProvider) {
+					t.Errorf("Wrong result of initialize: %s", r.Result)
+				}
+				checkReply(t, replies, "2", rpcMethodNotFound)
+				checkReply(t, replies, "3", 0)
+				checkReply(t, replies, "4", rpcInvalidRequest)
+				if _, ok := replies["5"]; ok {
+					t.Errorf("Request after exit is handled")
+				}
+			},
+		},
+		{
+			name: "code actions of broken file",
+			msgs: []string{
+				`{"jsonrpc":"2.0","id":1,"method":"textDocument/codeAction","params":{"textDocument":{"uri":"` + broken + `"}}}`,
+			},
+			check: func(t *testing.T, replies map[string]*rpcMessage, requests []*rpcMessage) {
+				r := checkReply(t, replies, "1", 0)
+				var actions []lspCodeAction
+				if r != nil && (json.Unmarshal(r.Result, &actions) != nil || len(actions) == 0 || actions[0].Title != "Organize imports") {
+					t.Errorf("Wrong code actions: %s", r.Result)
+				}
+			},
+		},
+		{
+			name: "edits in utf16",
+			msgs: []string{
+				`{"jsonrpc":"2.0","id":1,"method":"workspace/executeCommand","params":{"command":"golime.add_comments","arguments":[{"file":"` + file + `","encoding":"bytes"}]}}`,
+			},
+			check: func(t *testing.T, replies map[string]*rpcMessage, requests []*rpcMessage) {
+				checkReply(t, replies, "1", 0)
+				if len(requests) != 1 || requests[0].Method != "workspace/applyEdit" {
+					t.Fatalf("Wrong requests of server: %v", requests)
+				}
+				var p struct {
+					Edit lspWorkspaceEdit `json:"edit"`
+				}
+				err := json.Unmarshal(requests[0].Params, &p)
+				if err != nil {
+					t.Fatalf("Error on unmarshal edit: %v", err)
+				}
+				edits := p.Edit.Changes[filenameToURI(file)]
+				expect := lspPosition{Line: 2, Character: 14}
+				if len(edits) != 1 || edits[0].Range.Start != expect {
+					t.Errorf("Wrong edits: %v, expected start %v", edits, expect)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, lineFraming := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/line=%v", tt.name, lineFraming), func(t *testing.T) {
+				var out bytes.Buffer
+				err := runLSP(rpcInput(lineFraming, tt.msgs...), &out)
+				if err != nil {
+					t.Fatalf("Error on run lsp: %v", err)
+				}
+				replies, requests := rpcOutput(t, &out)
+				tt.check(t, replies, requests)
+			})
+		}
+	}
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"go/build"
 	"log"
-	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cweill/gotests"
@@ -20,13 +23,31 @@ var (
 	version = "v0.0.0.5"
 )
 
-type Cmd func(data []byte) (out interface{}, err error)
+type Cmd func(ctx context.Context, data []byte) (out interface{}, err error)
 
-func (c Cmd) Run(data []byte) (out interface{}, err error) {
+// Run - run command until it is done or ctx is done
+// Command may not check ctx itself, then its result is dropped on cancel.
+func (c Cmd) Run(ctx context.Context, data []byte) (out interface{}, err error) {
 	if c == nil {
 		return nil, fmt.Errorf("not implemented")
 	}
-	return c(data)
+
+	type result struct {
+		out interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := c(ctx, data)
+		done <- result{out, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.out, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 func Run(i int) bool {
@@ -36,66 +57,231 @@ func Run(i int) bool {
 type Result map[string]interface{}
 
 var commands = map[string]Cmd{
-	// "godef": func(data []byte) (out interface{}, err error) {
+	// "godef": func(ctx context.Context, data []byte) (out interface{}, err error) {
 
 	// },
-	"gen": func(data []byte) (out interface{}, err error) {
+	"gen": func(ctx context.Context, data []byte) (out interface{}, err error) {
 		log.Printf("args: %v", os.Args)
 		return Result{"gen": "ok"}, nil
 	},
-	"exit": func(data []byte) (out interface{}, err error) {
+	"exit": func(ctx context.Context, data []byte) (out interface{}, err error) {
 		go func() {
 			time.Sleep(300 * time.Millisecond)
-			os.Exit(0)
+			exit(0)
 		}()
 		return Result{"time": "300ms"}, nil
 	},
-	"version": func(data []byte) (out interface{}, err error) {
+	"version": func(ctx context.Context, data []byte) (out interface{}, err error) {
 		return Result{"version": version}, nil
 	},
-	"imports": func(data []byte) (out interface{}, err error) {
-		imports, err := tools.GetAllImportPaths()
+	"imports": func(ctx context.Context, data []byte) (out interface{}, err error) {
+		var s struct {
+			// Dir - directory of package which imports, it selects go.mod
+			// and only import paths visible from it are returned
+			Dir string `json:"dir"`
+			// File - file which imports, its directory is used if dir is empty
+			File string `json:"file"`
+			// Query - rank import paths by query, all are returned if empty
+			Query string `json:"query"`
+			// Limit - max count of ranked import paths
+			Limit int `json:"limit"`
+		}
+		if len(data) > 0 {
+			err = json.Unmarshal(data, &s)
+			if err != nil {
+				return nil, errors.Wrap(err, "error on unmarshal data")
+			}
+		}
+		if s.Dir == "" && s.File != "" {
+			s.Dir = filepath.Dir(s.File)
+		}
+		if s.Query == "" && s.Limit <= 0 {
+			imports, err := importIndex().ImportPaths(ctx, s.Dir)
+			if err != nil {
+				return nil, err
+			}
+			status, _ := importIndex().Status()
+			return Result{"imports": imports, "index": status}, nil
+		}
+
+		candidates, err := importIndex().Search(ctx, s.Dir, s.Query, s.Limit)
+		if err != nil {
+			return nil, err
+		}
+		imports := make([]string, len(candidates))
+		for i, c := range candidates {
+			imports[i] = c.Path
+		}
+		status, _ := importIndex().Status()
+		return Result{"imports": imports, "candidates": candidates, "index": status}, nil
+	},
+	"packages": func(ctx context.Context, data []byte) (out interface{}, err error) {
+		var s struct {
+			// Dir - directory of package which imports, it selects go.mod
+			Dir string `json:"dir"`
+		}
+		if len(data) > 0 {
+			err = json.Unmarshal(data, &s)
+			if err != nil {
+				return nil, errors.Wrap(err, "error on unmarshal data")
+			}
+		}
+		pkgs, err := importIndex().Packages(ctx, s.Dir)
 		if err != nil {
 			return nil, err
 		}
-		return Result{"imports": imports}, nil
+		status, _ := importIndex().Status()
+		return Result{"packages": pkgs, "index": status}, nil
 	},
-	"add_comments": func(data []byte) (out interface{}, err error) {
+	"index_status": func(ctx context.Context, data []byte) (out interface{}, err error) {
+		status, roots := importIndex().Status()
+		return Result{"status": status, "roots": roots}, nil
+	},
+	"add_comments": func(ctx context.Context, data []byte) (out interface{}, err error) {
 		var s struct {
 			File string `json:"file"`
+			// Templates - templates of comments by kind of declaration,
+			// they override templates of project config
+			Templates tools.CommentTemplates `json:"templates"`
+			// All - stub also fields, interface methods, specs of groups and package comment
+			All bool `json:"all"`
+			fileContent
+			editOptions
 
+			// IsRuneCount - deprecated, use "encoding": "runes"
 			IsRuneCount bool `json:"isRuneCount"`
 		}
 		err = json.Unmarshal(data, &s)
 		if err != nil {
 			return nil, errors.Wrap(err, "error on unmarshal data")
 		}
-		out, err = tools.AddComments(s.File, s.IsRuneCount)
+		if s.IsRuneCount && s.Encoding == "" {
+			s.Encoding = tools.EncodingRunes
+		}
+		edits, err := tools.AddCommentsWith(s.File, s.src(), tools.CommentOptions{Templates: s.Templates, All: s.All})
 		if err != nil {
 			return nil, errors.Wrap(err, "error on add comments")
 		}
-		return Result{"status": "ok", "result": out}, nil
+		return s.result(edits, s.File, s.src())
 	},
-	"add_import": func(data []byte) (out interface{}, err error) {
+	"check_comments": func(ctx context.Context, data []byte) (out interface{}, err error) {
+		var s struct {
+			File string `json:"file"`
+			fileContent
+			editOptions
+		}
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on unmarshal data")
+		}
+		problems, err := tools.CheckComments(s.File, s.src())
+		if err != nil {
+			return nil, errors.Wrap(err, "error on check comments")
+		}
+		for _, p := range problems {
+			_, err = s.result(p.Edits, s.File, s.src())
+			if err != nil {
+				return nil, err
+			}
+		}
+		return Result{"status": "ok", "problems": problems}, nil
+	},
+	"add_import": func(ctx context.Context, data []byte) (out interface{}, err error) {
 		type st struct {
+			// Import - import path, if it is empty then import of selector is resolved
 			Import string `json:"import"`
-			File   string `json:"file"`
+			// Name - alias of import, "_" for blank or "." for dot import
+			Name string `json:"name"`
+			// Imports - import paths which are added by the same edit
+			Imports []string `json:"imports"`
+			File    string   `json:"file"`
+			selectorArgs
+			fileContent
+			editOptions
 		}
 		var s st
 		err = json.Unmarshal(data, &s)
 		if err != nil {
 			return nil, errors.Wrap(err, "error on umarshal data")
 		}
-		res, err := tools.AddImport(s.File, s.Import)
+
+		// import of unresolved selector: the best candidate is added
+		var candidates []tools.ImportCandidate
+		if s.Import == "" && len(s.Imports) == 0 {
+			candidates, err = s.resolve(ctx, s.File, s.src(), s.Encoding)
+			if err != nil {
+				return nil, err
+			}
+			s.Import = candidates[0].Path
+		}
+
+		var imports []tools.Import
+		if s.Import != "" {
+			imports = append(imports, tools.Import{Name: s.Name, Path: s.Import})
+		}
+		for _, p := range s.Imports {
+			imports = append(imports, tools.Import{Path: p})
+		}
+		edits, err := tools.AddImports(s.File, imports, s.src())
 		if err != nil {
 			return nil, errors.Wrap(err, "error on add import")
 		}
-		return Result{"status": "ok", "result": res}, nil
+		res, err := s.result(edits, s.File, s.src())
+		if err != nil {
+			return nil, err
+		}
+		if candidates != nil {
+			res["import"] = s.Import
+			res["candidates"] = candidates
+		}
+		return res, nil
 	},
-	"gotest": func(data []byte) (out interface{}, err error) {
+	"organize_imports": func(ctx context.Context, data []byte) (out interface{}, err error) {
+		var s struct {
+			File string `json:"file"`
+			// Local - comma separated prefixes of local imports, module path by default
+			Local string `json:"local"`
+			fileContent
+			editOptions
+		}
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on unmarshal data")
+		}
+		edits, err := tools.OrganizeImports(ctx, s.File, s.src(), tools.OrganizeOptions{
+			LocalPrefix: s.Local,
+			Resolve: func(ctx context.Context, pkgName, symbol string) ([]tools.ImportCandidate, error) {
+				return importIndex().Resolve(ctx, filepath.Dir(s.File), pkgName, symbol)
+			},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error on organize imports")
+		}
+		return s.result(edits, s.File, s.src())
+	},
+	"resolve": func(ctx context.Context, data []byte) (out interface{}, err error) {
+		var s struct {
+			File string `json:"file"`
+			selectorArgs
+			fileContent
+			editOptions
+		}
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on unmarshal data")
+		}
+		candidates, err := s.resolve(ctx, s.File, s.src(), s.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		return Result{"candidates": candidates}, nil
+	},
+	"gotest": func(ctx context.Context, data []byte) (out interface{}, err error) {
 		type st struct {
 			File         string `json:"file"`
 			FunctionName string `json:"function"`
+			fileContent
+			editOptions
 		}
 		var s st
 		err = json.Unmarshal(data, &s)
@@ -106,63 +292,328 @@ var commands = map[string]Cmd{
 		if err != nil {
 			return nil, errors.Wrap(err, "error on compile regexp")
 		}
-		ts, err := gotests.GenerateTests(s.File, &gotests.Options{
+
+		// gotests reads files only from disk, so run it on mirror of dir with unsaved files
+		dir, srcFile := filepath.Split(s.File)
+		if dir == "" {
+			dir = "."
+		}
+		overlaid := map[string][]byte{}
+		if src := s.src(); src != nil {
+			overlaid[srcFile] = src
+		}
+		genFile := s.File
+		if len(overlaid) > 0 || len(tools.DefaultOverlay.Dir(dir)) > 0 {
+			tmpDir, cleanup, err := tools.MirrorDir(dir, overlaid)
+			if err != nil {
+				return nil, errors.Wrap(err, "error on mirror dir")
+			}
+			defer cleanup()
+			genFile = filepath.Join(tmpDir, srcFile)
+		}
+
+		ts, err := gotests.GenerateTests(genFile, &gotests.Options{
 			Only: rgx,
 		})
 		if err != nil {
 			return nil, errors.Wrap(err, "error on get tests")
 		}
+		// each test file is replaced entirely (or created)
 		var paths []string
+		var edits []tools.TextEdit
 		for _, t := range ts {
-			err = ioutil.WriteFile(t.Path, t.Output, 0644)
+			path := filepath.Join(dir, filepath.Base(t.Path))
+			prev, err := tools.ReadFile(path, nil)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, errors.Wrapf(err, "error on read test file (%v)", path)
+			}
+			fileEdits := []tools.TextEdit{{File: path, End: len(prev), NewText: string(t.Output)}}
+			err = tools.EncodeOffsets(fileEdits, prev, s.Encoding)
 			if err != nil {
-				return nil, errors.Wrapf(err, "error on write test result (%v)", t.Path)
+				return nil, errors.Wrap(err, "error on encode offsets")
 			}
-			paths = append(paths, t.Path)
+			edits = append(edits, fileEdits...)
+			paths = append(paths, path)
 		}
-		return Result{"test_files": paths}, nil
+		return Result{"status": "ok", "result": edits, "test_files": paths}, nil
 	},
-	// "goiface": func(data []byte) (out interface{}, err error) {
-	// 	type st struct {
-	// 		Receiver string `json:"receiver"`
-	// 		Iface    string `json:"iface"`
-	// 		Filepath string `json:"filepath"`
-	// 	}
-	// 	var s st
-	// 	err = json.Unmarshal(data, &s)
-	// 	if err != nil {
-	// 		return nil, errors.Wrap(err, "error on unmarshal struct")
-	// 	}
+	"did_open":   overlaySet,
+	"did_change": overlaySet,
+	"did_close": func(ctx context.Context, data []byte) (out interface{}, err error) {
+		var s struct {
+			File string `json:"file"`
+		}
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on unmarshal data")
+		}
+		tools.DefaultOverlay.Delete(s.File)
+		return Result{"status": "ok"}, nil
+	},
+	"impl": func(ctx context.Context, data []byte) (out interface{}, err error) {
+		var s struct {
+			// Receiver - receiver of methods, e.g. "f *File"
+			Receiver string `json:"receiver"`
+			// Iface - interface, e.g. "io.Reader", "net/http.Handler" or "Store[string, *User]"
+			Iface string `json:"iface"`
+			// File - file of package with declaration of type of receiver
+			File string `json:"file"`
+			// Body - style of bodies of stubs: "panic" (default), "zero" or "delegate"
+			Body string `json:"body"`
+			// Field - field which "delegate" stubs call, embedded one by default
+			Field string `json:"field"`
+			// Template - file of text/template of stub, it overrides body
+			Template string `json:"template"`
+			fileContent
+			editOptions
+		}
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on unmarshal data")
+		}
+		impl, err := tools.ImplWith(s.File, s.src(), s.Receiver, s.Iface, tools.ImplOptions{
+			Body:     s.Body,
+			Field:    s.Field,
+			Template: s.Template,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error on impl")
+		}
+		res, err := s.result(impl.Edits, s.File, s.src())
+		if err != nil {
+			return nil, err
+		}
+		// methods which receiver has with other signatures are not stubbed
+		res["conflicts"] = impl.Conflicts
+		return res, nil
+	},
+	"mock": func(ctx context.Context, data []byte) (out interface{}, err error) {
+		var s struct {
+			// Iface - interface, e.g. "io.Reader", "Store" or "Store[string, *User]"
+			Iface string `json:"iface"`
+			// File - file of package where interface is resolved
+			File string `json:"file"`
+			// Name - name of type of mock, "Mock" with name of interface by default
+			Name string `json:"name"`
+			// Output - file of mock, "mock_<name of interface>_test.go" in dir of file by default
+			Output string `json:"output"`
+			// External - mock is in external test package
+			External bool `json:"external"`
+			fileContent
+			editOptions
+		}
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on unmarshal data")
+		}
+		edits, err := tools.Mock(s.File, s.src(), s.Iface, tools.MockOptions{
+			Name:     s.Name,
+			File:     s.Output,
+			External: s.External,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error on mock")
+		}
+		return s.result(edits, s.File, s.src())
+	},
+}
 
-	// 	file, err := os.OpenFile(s.Filepath, os.O_WRONLY, 0600)
-	// 	if err != nil {
-	// 		return nil, errors.Wrap(err, "error on open file")
-	// 	}
-	// 	defer file.Close()
+var (
+	indexOnce sync.Once
+	index     *tools.Index
+)
 
-	// 	_, err = file.Seek(0, os.SEEK_END)
-	// 	if err != nil {
-	// 		return nil, errors.Wrap(err, "error on seek")
-	// 	}
+// importIndex - index of import paths, it is loaded on first use
+func importIndex() *tools.Index {
+	indexOnce.Do(func() {
+		index = tools.NewIndex(tools.DefaultIndexFile())
+		index.Build = buildContext()
+		if *indexMaxAge > 0 {
+			index.MaxAge = *indexMaxAge
+		}
+	})
+	return index
+}
 
-	// 	err = goiface.Impl(s.Receiver, s.Iface, file)
-	// 	if err != nil {
-	// 		return nil, errors.Wrap(err, "error on impl")
-	// 	}
-	// 	panic("Not implemented")
-	// },
+// warmIndex - keep index of import paths warm in long-lived modes
+// Queries are answered immediately, index is refreshed in background.
+func warmIndex() {
+	idx := importIndex()
+	idx.Background = true
+	go idx.KeepWarm(context.Background())
+}
+
+// fileContent - optional content of unsaved buffer
+// It takes precedence over file on disk and overlay.
+type fileContent struct {
+	Content *string `json:"content"`
+}
+
+func (c fileContent) src() []byte {
+	if c.Content == nil {
+		return nil
+	}
+	return []byte(*c.Content)
+}
+
+// overlaySet - set content of unsaved buffer for all next commands
+func overlaySet(ctx context.Context, data []byte) (out interface{}, err error) {
+	var s struct {
+		File    string `json:"file"`
+		Content string `json:"content"`
+	}
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on unmarshal data")
+	}
+	tools.DefaultOverlay.Set(s.File, []byte(s.Content))
+	return Result{"status": "ok"}, nil
+}
+
+// selectorArgs - unresolved selector like "sync.WaitGroup":
+// given explicitly or found at offset of file
+type selectorArgs struct {
+	Selector string `json:"selector"`
+	// Offset - offset in file in encoding of editOptions
+	Offset *int `json:"offset"`
+	// Dir - directory of package which imports, dir of file by default
+	Dir string `json:"dir"`
+}
+
+// resolve - import paths of packages which export selector, the best is the first one
+func (a selectorArgs) resolve(ctx context.Context, filename string, src []byte, enc tools.Encoding) ([]tools.ImportCandidate, error) {
+	var pkgName, symbol string
+	switch {
+	case a.Selector != "":
+		ss := strings.SplitN(a.Selector, ".", 2)
+		if len(ss) != 2 || ss[0] == "" || ss[1] == "" {
+			return nil, errBadRequest(errors.Errorf("wrong selector: %q", a.Selector))
+		}
+		pkgName, symbol = ss[0], ss[1]
+	case a.Offset != nil:
+		src, err := tools.ReadFile(filename, src)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on read file")
+		}
+		offset, err := tools.DecodeOffset(src, *a.Offset, enc)
+		if err != nil {
+			return nil, errBadRequest(err)
+		}
+		pkgName, symbol, err = tools.SelectorAt(filename, src, offset)
+		if err != nil {
+			return nil, errBadRequest(err)
+		}
+	default:
+		return nil, errBadRequest(errors.New("import, selector or offset is required"))
+	}
+
+	dir := a.Dir
+	if dir == "" && filename != "" {
+		dir = filepath.Dir(filename)
+	}
+	candidates, err := importIndex().Resolve(ctx, dir, pkgName, symbol)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on resolve selector")
+	}
+	if len(candidates) == 0 {
+		return nil, &Error{Code: ErrCodeNotFound, Message: fmt.Sprintf("no package exports %s.%s", pkgName, symbol)}
+	}
+	return candidates, nil
+}
+
+// editOptions - options of commands which return []tools.TextEdit
+type editOptions struct {
+	// Encoding - unit of offsets in edits: bytes (default), runes or utf16
+	Encoding tools.Encoding `json:"encoding"`
+}
+
+// result - response of editing command with edits of file
+// Offsets of edits are converted into requested encoding,
+// edits of other files are converted by their own content.
+func (o editOptions) result(edits []tools.TextEdit, filename string, src []byte) (Result, error) {
+	src, err := tools.ReadFile(filename, src)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read file")
+	}
+	for i, e := range edits {
+		fileSrc := src
+		if e.File != "" && e.File != filename {
+			fileSrc, err = tools.ReadFile(e.File, nil)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, errors.Wrap(err, "error on read file")
+			}
+		}
+		err = tools.EncodeOffsets(edits[i:i+1], fileSrc, o.Encoding)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on encode offsets")
+		}
+	}
+	if edits == nil {
+		edits = []tools.TextEdit{}
+	}
+	return Result{"status": "ok", "result": edits}, nil
 }
 
 type CmdArgs struct {
+	// ID - optional id of request, it is used for cancel of request
+	ID   string          `json:"id,omitempty"`
 	Cmd  string          `json:"cmd"`
 	Data json.RawMessage `json:"data"`
+
+	// Timeout - overrides default timeout of command (in milliseconds)
+	Timeout int64 `json:"timeout_ms,omitempty"`
+}
+
+const defaultCmdTimeout = 10 * time.Second
+
+// cmdTimeouts - timeouts of commands which differ from defaultCmdTimeout
+var cmdTimeouts = map[string]time.Duration{
+	"imports":  time.Minute,
+	"packages": time.Minute,
+	"gotest":   30 * time.Second,
+	// first resolve parses packages which may export selector
+	"resolve":          time.Minute,
+	"add_import":       time.Minute,
+	"organize_imports": time.Minute,
+	// packages are type-checked from source
+	"impl": time.Minute,
+	"mock": time.Minute,
+}
+
+func (a CmdArgs) timeout() time.Duration {
+	if a.Timeout > 0 {
+		return time.Duration(a.Timeout) * time.Millisecond
+	}
+	if t, ok := cmdTimeouts[a.Cmd]; ok {
+		return t
+	}
+	return defaultCmdTimeout
 }
 
 var (
 	versionFlag = flag.Bool("v", false, "Version of golime")
 	isServer    = flag.Bool("s", false, "Start as server")
+	isLSP       = flag.Bool("lsp", false, "Start as Language Server Protocol server on stdio")
+	isStdio     = flag.Bool("stdio", false, "Serve JSON-RPC 2.0 requests on stdio")
+	listenAddr  = flag.String("addr", "localhost:0", "Listen address of server (port is chosen by system by default, see -discover)")
+	socketPath  = flag.String("socket", "", "Unix socket path of server (instead of -addr)")
+	workspace   = flag.String("workspace", ".", "Workspace directory of server discovery file")
+	discover    = flag.Bool("discover", false, "Print discovery of server started for -workspace")
+	goosFlag    = flag.String("goos", "", "GOOS of build constraints of packages (default $GOOS)")
+	goarchFlag  = flag.String("goarch", "", "GOARCH of build constraints of packages (default $GOARCH)")
+	tagsFlag    = flag.String("tags", "", "Comma separated build tags of packages")
+	indexMaxAge = flag.Duration("index-max-age", tools.DefaultIndexMaxAge, "Age of import paths of index after which they are refreshed")
 )
 
+// buildContext - build constraints of packages from flags
+func buildContext() *build.Context {
+	var tags []string
+	if *tagsFlag != "" {
+		tags = strings.Split(*tagsFlag, ",")
+	}
+	return tools.NewBuildContext(*goosFlag, *goarchFlag, tags)
+}
+
 func main() {
 	flag.Parse()
 	if *versionFlag {
@@ -170,45 +621,60 @@ func main() {
 		return
 	}
 
-	if *isServer {
-		http.HandleFunc("/cmd", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			var cmd CmdArgs
-			err := json.NewDecoder(req.Body).Decode(&cmd)
-			if err != nil {
-				writeError(w, err)
-				return
-			}
-			out, err := commands[cmd.Cmd].Run(cmd.Data)
-			if err != nil {
-				writeError(w, err)
-				return
-			}
+	if *isLSP {
+		warmIndex()
+		err := runLSP(os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatalf("Error on lsp: %v", err)
+		}
+		return
+	}
+
+	if *isStdio {
+		warmIndex()
+		err := runStdio(os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatalf("Error on stdio: %v", err)
+		}
+		return
+	}
+
+	if *discover {
+		d, err := readDiscovery(*workspace)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			os.Exit(1)
+		}
+		json.NewEncoder(os.Stdout).Encode(d) // nolint: gas
+		return
+	}
 
-			json.NewEncoder(w).Encode(out)
-		}))
-		http.HandleFunc("/stop", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			os.Exit(0)
-		}))
-		log.Printf("Server is started on: %s", ":8601")
-		log.Fatal(http.ListenAndServe(":8601", nil))
+	if *isServer {
+		warmIndex()
+		err := runServer(*listenAddr, *socketPath, *workspace)
+		if err != nil {
+			log.Printf("Error on server: %v", err)
+			exit(1)
+		}
 		return
 	}
 
-	if len(os.Args) < 2 {
+	// command and its data follow flags, e.g. golime -tags=integration packages '{...}'
+	args := flag.Args()
+	if len(args) < 1 {
 		log.Printf("Command is empty")
 		return
 	}
 
-	cmd := os.Args[1]
-	var data []byte
+	cmd := CmdArgs{Cmd: args[0]}
 
-	if len(os.Args) > 2 {
-		data = []byte(os.Args[2])
+	if len(args) > 1 {
+		cmd.Data = []byte(args[1])
 	}
 
-	res, err := commands[cmd].Run(data)
+	res, err := running.Run(context.Background(), cmd)
 	if err != nil {
-		log.Printf("Error: %v", err)
+		json.NewEncoder(os.Stdout).Encode(ErrorResult{Error: newError(err)}) // nolint: gas
 		os.Exit(1)
 	}
 
@@ -233,8 +699,3 @@ func main() {
 	// }
 	// log.Printf("count: %d", count)
 }
-
-func writeError(w http.ResponseWriter, err error) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write([]byte(fmt.Sprintf("{\"error\": \"%s\"}", err.Error())))
-}
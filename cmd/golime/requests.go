@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// running - requests in progress of current process
+var running = &requests{cancels: make(map[string]*context.CancelFunc)}
+
+// requests - registry of running commands keyed by request id
+type requests struct {
+	mu      sync.Mutex
+	cancels map[string]*context.CancelFunc
+}
+
+// Run - run command with its timeout
+// While command is running it can be cancelled by id of request.
+func (r *requests) Run(ctx context.Context, args CmdArgs) (interface{}, error) {
+	ctx, done := r.Start(ctx, args.ID, args.timeout())
+	defer done()
+
+	cmd, ok := commands[args.Cmd]
+	if !ok {
+		return nil, errUnknownCommand(args.Cmd)
+	}
+
+	out, err := cmd.Run(ctx, args.Data)
+	if err != nil && ctx.Err() != nil {
+		return nil, errors.Wrapf(ctx.Err(), "command %q is stopped", args.Cmd)
+	}
+	return out, err
+}
+
+// Start - make context of request with timeout
+// If id is not empty, request can be cancelled by id until done is called.
+func (r *requests) Start(ctx context.Context, id string, timeout time.Duration) (_ context.Context, done func()) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	if id == "" {
+		return ctx, cancel
+	}
+
+	r.mu.Lock()
+	if prev, ok := r.cancels[id]; ok {
+		// request with the same id is stale
+		(*prev)()
+	}
+	r.cancels[id] = &cancel
+	r.mu.Unlock()
+
+	return ctx, func() {
+		cancel()
+		r.remove(id, &cancel)
+	}
+}
+
+// Cancel - cancel running request, returns false if request is not found
+func (r *requests) Cancel(id string) bool {
+	r.mu.Lock()
+	cancel, ok := r.cancels[id]
+	r.mu.Unlock()
+	if ok {
+		(*cancel)()
+	}
+	return ok
+}
+
+// remove - remove request if it is not replaced by newer one with the same id
+func (r *requests) remove(id string, cancel *context.CancelFunc) {
+	r.mu.Lock()
+	if r.cancels[id] == cancel {
+		delete(r.cancels, id)
+	}
+	r.mu.Unlock()
+}
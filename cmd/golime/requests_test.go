@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRequestsCancel(t *testing.T) {
+	r := &requests{cancels: make(map[string]*context.CancelFunc)}
+
+	ctx, done := r.Start(context.Background(), "1", time.Minute)
+	if r.Cancel("2") {
+		t.Errorf("Unknown request is cancelled")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("Request is done before cancel: %v", ctx.Err())
+	}
+	if !r.Cancel("1") {
+		t.Errorf("Request is not found")
+	}
+	if ctx.Err() != context.Canceled {
+		t.Errorf("Wrong error of cancelled request: %v", ctx.Err())
+	}
+	done()
+	if r.Cancel("1") {
+		t.Errorf("Done request is cancelled")
+	}
+
+	// request with the same id replaces stale one
+	stale, staleDone := r.Start(context.Background(), "1", time.Minute)
+	ctx, done = r.Start(context.Background(), "1", time.Minute)
+	if stale.Err() != context.Canceled {
+		t.Errorf("Stale request is not cancelled: %v", stale.Err())
+	}
+	staleDone()
+	if !r.Cancel("1") || ctx.Err() != context.Canceled {
+		t.Errorf("Request is removed by done of stale one")
+	}
+	done()
+	if len(r.cancels) != 0 {
+		t.Errorf("Requests are not removed: %v", r.cancels)
+	}
+}
+
+func TestRequestsRunCancel(t *testing.T) {
+	started := make(chan struct{})
+	commands["test_wait"] = func(ctx context.Context, data []byte) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	defer delete(commands, "test_wait")
+
+	r := &requests{cancels: make(map[string]*context.CancelFunc)}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := r.Run(context.Background(), CmdArgs{ID: "wait", Cmd: "test_wait"})
+		errc <- err
+	}()
+	<-started
+	if !r.Cancel("wait") {
+		t.Fatalf("Running request is not found")
+	}
+
+	select {
+	case err := <-errc:
+		if errors.Cause(err) != context.Canceled {
+			t.Errorf("Wrong error: %v", err)
+		}
+		if code := newError(err).Code; code != ErrCodeCancelled {
+			t.Errorf("Wrong code: %s", code)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Request is not stopped on cancel")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Discovery - content of discovery file of running server
+// Editor plugin finds it by workspace directory, see discoveryFile.
+type Discovery struct {
+	Workspace string `json:"workspace"`
+	Network   string `json:"network"` // "tcp" or "unix"
+	Address   string `json:"address"`
+	Pid       int    `json:"pid"`
+	Version   string `json:"version"`
+}
+
+var (
+	cleanupsMu sync.Mutex
+	cleanups   []func()
+)
+
+// atExit - register func which is called on exit of golime
+func atExit(fn func()) {
+	cleanupsMu.Lock()
+	cleanups = append(cleanups, fn)
+	cleanupsMu.Unlock()
+}
+
+// exit - run registered cleanups and exit with code
+func exit(code int) {
+	cleanupsMu.Lock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	cleanups = nil
+	cleanupsMu.Unlock()
+	os.Exit(code)
+}
+
+// runServer - start HTTP server on unix socket (if socket is not empty) or on tcp addr
+func runServer(addr, socket, workspace string) error {
+	network, address := "tcp", addr
+	if socket != "" {
+		network, address = "unix", socket
+	}
+
+	ln, err := listen(network, address)
+	if err != nil {
+		return errors.Wrapf(err, "error on listen %s %s", network, address)
+	}
+	if network == "unix" {
+		atExit(func() { os.Remove(address) })
+	}
+
+	workspace, err = filepath.Abs(workspace)
+	if err != nil {
+		return errors.Wrap(err, "error on get workspace path")
+	}
+	d := Discovery{
+		Workspace: workspace,
+		Network:   network,
+		Address:   ln.Addr().String(),
+		Pid:       os.Getpid(),
+		Version:   version,
+	}
+	err = writeDiscovery(d)
+	if err != nil {
+		return errors.Wrap(err, "error on write discovery file")
+	}
+	atExit(func() { os.Remove(discoveryFile(workspace)) })
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		exit(0)
+	}()
+
+	log.Printf("Server is started on: %s %s", network, d.Address)
+	log.Printf("Discovery file: %s", discoveryFile(workspace))
+	return http.Serve(ln, serverHandler(network))
+}
+
+// serverHandler - handler of commands, on tcp only requests to loopback host are allowed.
+// Requests of browsers (with Origin header) are rejected, so web pages
+// can not run commands on local server.
+func serverHandler(network string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cmd", func(w http.ResponseWriter, req *http.Request) {
+		var cmd CmdArgs
+		err := json.NewDecoder(req.Body).Decode(&cmd)
+		if err != nil {
+			writeError(w, errBadRequest(err))
+			return
+		}
+		// request is cancelled when client closes connection
+		out, err := running.Run(req.Context(), cmd)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(out)
+	})
+	mux.HandleFunc("/cancel", func(w http.ResponseWriter, req *http.Request) {
+		var cancel struct {
+			ID string `json:"id"`
+		}
+		err := json.NewDecoder(req.Body).Decode(&cancel)
+		if err != nil {
+			writeError(w, errBadRequest(err))
+			return
+		}
+		json.NewEncoder(w).Encode(Result{"cancelled": running.Cancel(cancel.ID)})
+	})
+	mux.HandleFunc("/stop", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, &Error{Code: ErrCodeNotAllowed, Message: "method is not allowed: " + req.Method})
+			return
+		}
+		exit(0)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Origin") != "" {
+			writeError(w, &Error{Code: ErrCodeForbidden, Message: "requests with Origin header are not allowed"})
+			return
+		}
+		if network == "tcp" && !isLoopbackHost(req.Host) {
+			writeError(w, &Error{Code: ErrCodeForbidden, Message: "host is not allowed: " + req.Host})
+			return
+		}
+		mux.ServeHTTP(w, req)
+	})
+}
+
+// isLoopbackHost - host (with optional port) is localhost or loopback IP
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func listen(network, address string) (net.Listener, error) {
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	// remove stale socket of dead server
+	if _, err := os.Stat(address); err == nil {
+		conn, err := net.Dial(network, address)
+		if err == nil {
+			conn.Close()
+			return nil, errors.Errorf("socket is already in use: %s", address)
+		}
+		err = os.Remove(address)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on remove stale socket")
+		}
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(address, 0600)
+	if err != nil {
+		ln.Close()
+		return nil, errors.Wrap(err, "error on chmod socket")
+	}
+	return ln, nil
+}
+
+// discoveryFile - path of discovery file for workspace:
+// $XDG_RUNTIME_DIR/golime/<hash of workspace>.json
+// or golime-<uid>/<hash of workspace>.json in temp dir
+func discoveryFile(workspace string) string {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("golime-%d", os.Getuid()))
+	if xdg := os.Getenv("XDG_RUNTIME_DIR"); xdg != "" {
+		dir = filepath.Join(xdg, "golime")
+	}
+	h := sha1.Sum([]byte(workspace))
+	return filepath.Join(dir, hex.EncodeToString(h[:8])+".json")
+}
+
+func writeDiscovery(d Discovery) error {
+	filename := discoveryFile(d.Workspace)
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return errors.Wrap(err, "error on create discovery dir")
+	}
+	err = checkPrivateDir(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	bs, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "error on marshal discovery")
+	}
+	return ioutil.WriteFile(filename, bs, 0600)
+}
+
+// readDiscovery - discovery of server started for workspace
+func readDiscovery(workspace string) (*Discovery, error) {
+	workspace, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on get workspace path")
+	}
+	filename := discoveryFile(workspace)
+	err = checkPrivateDir(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read discovery file")
+	}
+	var d Discovery
+	err = json.Unmarshal(bs, &d)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on unmarshal discovery file")
+	}
+	return &d, nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e := newError(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.httpStatus())
+	json.NewEncoder(w).Encode(ErrorResult{Error: e})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestServerHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		method  string
+		path    string
+		host    string
+		origin  string
+		status  int
+	}{
+		{"localhost", "tcp", "POST", "/cmd", "localhost:8080", "", http.StatusOK},
+		{"loopback ip", "tcp", "POST", "/cmd", "127.0.0.1:8080", "", http.StatusOK},
+		{"loopback ipv6", "tcp", "POST", "/cmd", "[::1]:8080", "", http.StatusOK},
+		{"other host", "tcp", "POST", "/cmd", "example.com:8080", "", http.StatusForbidden},
+		{"origin", "tcp", "POST", "/cmd", "localhost:8080", "http://example.com", http.StatusForbidden},
+		{"host of unix socket", "unix", "POST", "/cmd", "golime", "", http.StatusOK},
+		{"origin on unix socket", "unix", "POST", "/cmd", "golime", "http://example.com", http.StatusForbidden},
+		{"stop by get", "tcp", "GET", "/stop", "localhost", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://"+tt.host+tt.path, strings.NewReader(`{"cmd": "version"}`))
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			serverHandler(tt.network).ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("Wrong status: %d, expected %d (%s)", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golime")
+	if err != nil {
+		t.Fatalf("Error on create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+
+	workspace := filepath.Join(dir, "workspace")
+	d := Discovery{Workspace: workspace, Network: "tcp", Address: "127.0.0.1:8080", Pid: 1, Version: version}
+	err = writeDiscovery(d)
+	if err != nil {
+		t.Fatalf("Error on write discovery: %v", err)
+	}
+
+	filename := discoveryFile(workspace)
+	if filepath.Dir(filename) != filepath.Join(dir, "golime") {
+		t.Errorf("Wrong discovery file: %s", filename)
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Error on stat discovery file: %v", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("Wrong mode of discovery file: %v", fi.Mode())
+	}
+
+	got, err := readDiscovery(workspace)
+	if err != nil {
+		t.Fatalf("Error on read discovery: %v", err)
+	}
+	if !reflect.DeepEqual(*got, d) {
+		t.Errorf("Wrong discovery: %v, expected %v", *got, d)
+	}
+
+	_, err = readDiscovery(filepath.Join(dir, "other"))
+	if err == nil || !os.IsNotExist(errors.Cause(err)) {
+		t.Errorf("Discovery of other workspace: %v", err)
+	}
+
+	// dir of other users is not trusted
+	err = os.Chmod(filepath.Dir(filename), 0755)
+	if err != nil {
+		t.Fatalf("Error on chmod discovery dir: %v", err)
+	}
+	if err = writeDiscovery(d); err == nil {
+		t.Errorf("Discovery is written into public dir")
+	}
+	if _, err = readDiscovery(workspace); err == nil {
+		t.Errorf("Discovery is read from public dir")
+	}
+}
+
+func TestDiscoveryTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golime")
+	if err != nil {
+		t.Fatalf("Error on create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Unsetenv("XDG_RUNTIME_DIR")
+	os.Setenv("TMPDIR", dir)
+
+	workspace := filepath.Join(dir, "workspace")
+	filename := discoveryFile(workspace)
+	expect := filepath.Join(dir, fmt.Sprintf("golime-%d", os.Getuid()))
+	if filepath.Dir(filename) != expect {
+		t.Errorf("Wrong discovery file: %s, expected in %s", filename, expect)
+	}
+	err = writeDiscovery(Discovery{Workspace: workspace, Network: "tcp", Address: "127.0.0.1:8080"})
+	if err != nil {
+		t.Fatalf("Error on write discovery: %v", err)
+	}
+	fi, err := os.Stat(expect)
+	if err != nil {
+		t.Fatalf("Error on stat discovery dir: %v", err)
+	}
+	if fi.Mode().Perm() != 0700 {
+		t.Errorf("Wrong mode of discovery dir: %v", fi.Mode())
+	}
+}
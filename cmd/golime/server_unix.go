@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// checkPrivateDir - dir is not a symlink, is owned by current user
+// and is not accessible by others, so discovery in it can be trusted
+func checkPrivateDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return errors.Wrap(err, "error on stat discovery dir")
+	}
+	if !fi.IsDir() {
+		return errors.Errorf("discovery dir is not a directory: %s", dir)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return errors.Errorf("discovery dir is owned by other user: %s", dir)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return errors.Errorf("discovery dir is accessible by other users (mode %v): %s", fi.Mode().Perm(), dir)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// checkPrivateDir - dir is not a symlink
+// Access of other users is restricted by ACL of user profile on windows.
+func checkPrivateDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return errors.Wrap(err, "error on stat discovery dir")
+	}
+	if !fi.IsDir() {
+		return errors.Errorf("discovery dir is not a directory: %s", dir)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// runStdio - serve JSON-RPC 2.0 requests with golime commands
+//
+// Method of request is a name of command and params are its data:
+//
+//	{"jsonrpc": "2.0", "id": 1, "method": "add_import", "params": {"file": "main.go", "import": "fmt"}}
+//
+// or method is "cmd" and params are CmdArgs:
+//
+//	{"jsonrpc": "2.0", "id": 1, "method": "cmd", "params": {"cmd": "add_import", "data": {...}}}
+//
+// Requests are handled concurrently, running request is cancelled by notification:
+//
+//	{"jsonrpc": "2.0", "method": "$/cancelRequest", "params": {"id": 1}}
+func runStdio(r io.Reader, w io.Writer) error {
+	conn := newRPCConn(r, w)
+	// wait responses on requests in progress
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		msg, err := conn.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if rerr, ok := err.(*rpcError); ok {
+				conn.Reply(nil, nil, rerr) // nolint: errcheck
+				continue
+			}
+			return errors.Wrap(err, "error on read message")
+		}
+		if msg.Method == "" {
+			// server sends no requests, so it is not a response
+			if msg.ID != nil {
+				conn.Reply(msg.ID, nil, &rpcError{Code: rpcInvalidRequest, Message: "method is expected"}) // nolint: errcheck
+			}
+			continue
+		}
+		if msg.Method == rpcCancelMethod {
+			var p rpcCancelParams
+			if json.Unmarshal(msg.Params, &p) == nil {
+				running.Cancel(rpcIDKey(p.ID))
+			}
+			continue
+		}
+
+		cmd, err := rpcCmdArgs(msg)
+		if err != nil || orderedCommands[cmd.Cmd] {
+			// changes of overlay are applied in order of arrival
+			stdioReply(conn, msg, cmd, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(msg *rpcMessage, cmd CmdArgs) {
+			defer wg.Done()
+			stdioReply(conn, msg, cmd, nil)
+		}(msg, cmd)
+	}
+}
+
+// orderedCommands - commands which change state for next commands
+var orderedCommands = map[string]bool{
+	"did_open":   true,
+	"did_change": true,
+	"did_close":  true,
+}
+
+func stdioReply(conn *rpcConn, msg *rpcMessage, cmd CmdArgs, err error) {
+	var out interface{}
+	if err == nil {
+		out, err = running.Run(context.Background(), cmd)
+	}
+	if msg.isNotification() {
+		return
+	}
+	err = conn.Reply(msg.ID, out, err)
+	if err != nil {
+		log.Printf("Error on write response: %v", err)
+	}
+}
+
+// rpcCmdArgs - command and its data from JSON-RPC request
+func rpcCmdArgs(msg *rpcMessage) (CmdArgs, error) {
+	var cmd CmdArgs
+	if msg.Method != "cmd" {
+		cmd = CmdArgs{Cmd: msg.Method, Data: msg.Params}
+	} else {
+		err := json.Unmarshal(msg.Params, &cmd)
+		if err != nil {
+			return cmd, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+	}
+	if cmd.ID == "" && msg.ID != nil {
+		cmd.ID = rpcIDKey(*msg.ID)
+	}
+	return cmd, nil
+}
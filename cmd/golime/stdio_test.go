@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestStdio(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs []string
+		// codes - codes of errors of replies, 0 is result
+		// requests are handled concurrently, so order is not checked
+		codes []int
+	}{
+		{
+			name: "command",
+			msgs: []string{
+				`{"jsonrpc":"2.0","id":1,"method":"version"}`,
+				`{"jsonrpc":"2.0","id":2,"method":"cmd","params":{"cmd":"version"}}`,
+				`{"jsonrpc":"2.0","method":"version"}`,
+			},
+			codes: []int{0, 0},
+		},
+		{
+			name: "unknown command",
+			msgs: []string{
+				`{"jsonrpc":"2.0","id":1,"method":"unknown"}`,
+				`{"jsonrpc":"2.0","id":2,"method":"cmd","params":[]}`,
+			},
+			codes: []int{rpcMethodNotFound, rpcInvalidParams},
+		},
+		{
+			name: "malformed messages",
+			msgs: []string{
+				`{"jsonrpc":"2.0","id":1,"method":"version"}`,
+				`not json`,
+				`[{"jsonrpc":"2.0","id":2,"method":"version"}]`,
+				`{"jsonrpc":"2.0","id":3,"method":"version"}`,
+			},
+			codes: []int{0, 0, rpcInvalidRequest, rpcParseError},
+		},
+		{
+			name: "id without method",
+			msgs: []string{
+				`{"jsonrpc":"2.0","id":1}`,
+				`{"jsonrpc":"2.0","id":2,"method":"version"}`,
+			},
+			codes: []int{0, rpcInvalidRequest},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, lineFraming := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/line=%v", tt.name, lineFraming), func(t *testing.T) {
+				var out bytes.Buffer
+				err := runStdio(rpcInput(lineFraming, tt.msgs...), &out)
+				if err != nil {
+					t.Fatalf("Error on run stdio: %v", err)
+				}
+				if lineFraming == bytes.HasPrefix(out.Bytes(), []byte("Content-Length")) {
+					t.Errorf("Wrong framing of output: %q", out.String())
+				}
+				var codes []int
+				for _, msg := range rpcMessages(t, &out) {
+					code := 0
+					if msg.Error != nil {
+						code = msg.Error.Code
+					}
+					codes = append(codes, code)
+				}
+				sort.Sort(sort.Reverse(sort.IntSlice(codes)))
+				if !reflect.DeepEqual(codes, tt.codes) {
+					t.Errorf("Wrong codes of replies: %v, expected %v", codes, tt.codes)
+				}
+			})
+		}
+	}
+}
+
+func TestStdioMalformedHeader(t *testing.T) {
+	in := rpcInput(false, `{"jsonrpc":"2.0","id":1,"method":"version"}`)
+	in.WriteString("Content-Lenght: 43\r\n\r\n")
+	in.WriteString(`{"jsonrpc":"2.0","id":2,"method":"version"}`)
+	in.WriteString("Content-Length: x\r\n\r\n{}\n")
+	rpcInput(false, `{"jsonrpc":"2.0","id":3,"method":"version"}`).WriteTo(in) // nolint: errcheck
+
+	var out bytes.Buffer
+	err := runStdio(in, &out)
+	if err != nil {
+		t.Fatalf("Error on run stdio: %v", err)
+	}
+	replies, _ := rpcOutput(t, &out)
+	checkReply(t, replies, "1", 0)
+	checkReply(t, replies, "null", rpcParseError)
+	checkReply(t, replies, "3", 0)
+	if _, ok := replies["2"]; ok {
+		t.Errorf("Message after malformed header is handled")
+	}
+}
+
+func TestRPCIDKey(t *testing.T) {
+	if rpcIDKey([]byte(`1`)) == rpcIDKey([]byte(`"1"`)) {
+		t.Errorf("Number and string ids have the same key")
+	}
+	if rpcIDKey([]byte(`9007199254740993`)) == rpcIDKey([]byte(`9007199254740992`)) {
+		t.Errorf("Large number ids have the same key")
+	}
+}
@@ -1,60 +1,90 @@
 package tools
 
 import (
-	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"io/ioutil"
-	"sort"
-	"unicode/utf8"
+	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
-type AddCommentsResult struct {
-	Pos  int    `json:"pos"`
-	Text string `json:"text"`
+// CommentOptions - options of AddCommentsWith
+type CommentOptions struct {
+	// Templates - templates of comments which override templates of project config
+	Templates CommentTemplates
+	// All - stub also exported fields of exported structs, methods of exported
+	// interfaces, specs of undocumented const and var groups, specs with several
+	// names and package comment in doc.go if no file of package has it
+	All bool
 }
 
-func AddComments(filename string, isRuneCount bool) (out []AddCommentsResult, err error) {
+// AddComments - insert stubs of doc comments for exported declarations
+// Stubs are made by templates of project config (see FindConfig).
+// Edits are sorted by position descending.
+func AddComments(filename string, src []byte) (out []TextEdit, err error) {
+	return AddCommentsWith(filename, src, CommentOptions{})
+}
+
+// AddCommentsWith - AddComments with options
+// Package comment is added by edit of doc.go, which creates it if it does not exist.
+func AddCommentsWith(filename string, src []byte, opt CommentOptions) (out []TextEdit, err error) {
 	// log.Printf("add comments on: %v", filename)
 
+	src, err = ReadFile(filename, src)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read file")
+	}
+
+	config, err := FindConfig(filepath.Dir(filename))
+	if err != nil {
+		return nil, errors.Wrap(err, "error on find config")
+	}
+	tt := opt.Templates.Merge(config.Comments)
+
 	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
 	if err != nil {
 		return nil, errors.Wrap(err, "error on parse file")
 	}
 
+	var stubs []commentStub
 	for i := range file.Decls {
 		switch d := file.Decls[i].(type) {
 		case *ast.FuncDecl:
-			out = appendDoc(out, d.Name, d.Doc, d.Pos())
+			// methods of unexported types are not documented (see CheckComments)
+			exported := d.Name.IsExported() && !hasUnexportedReceiver(d)
+			stubs = appendStub(stubs, funcCommentData(d), exported, d.Doc, d.Pos())
 		case *ast.GenDecl:
 			if d.Tok == token.IMPORT {
 				continue
 			}
-			if len(d.Specs) == 1 {
-				if !docIsEmpty(d.Doc) {
-					continue
+			// doc of single spec is doc of declaration
+			grouped := len(d.Specs) != 1
+			for _, s := range d.Specs {
+				doc, pos := d.Doc, d.Pos()
+				if grouped {
+					doc, pos = nil, s.Pos()
 				}
-				switch s := d.Specs[0].(type) {
+				switch s := s.(type) {
 				case *ast.TypeSpec:
-					out = appendDoc(out, s.Name, s.Doc, d.Pos())
+					if docIsEmpty(doc) {
+						doc = s.Doc
+					}
+					stubs = appendStub(stubs, typeCommentData(s), s.Name.IsExported(), doc, pos)
+					if opt.All && s.Name.IsExported() {
+						stubs = appendMemberStubs(stubs, s)
+					}
 				case *ast.ValueSpec:
-					if len(s.Names) != 1 {
+					if docIsEmpty(doc) {
+						doc = s.Doc
+					}
+					// specs of groups and with several names only with All
+					if (grouped || len(s.Names) != 1) && (!opt.All || !docIsEmpty(d.Doc)) {
 						continue
 					}
-					out = appendDoc(out, s.Names[0], s.Doc, d.Pos())
-					// default:
-					// 	log.Printf("Unknown spec: %T", s)
-				}
-				continue
-			}
-			for _, s := range d.Specs {
-				switch s := s.(type) {
-				case *ast.TypeSpec:
-					out = appendDoc(out, s.Name, s.Doc, s.Pos())
+					stubs = appendStub(stubs, valueCommentData(d.Tok, s), anyExported(s.Names), doc, pos)
 					// default:
 					// 	log.Printf("Unknown spec: %T", s)
 				}
@@ -64,35 +94,149 @@ func AddComments(filename string, isRuneCount bool) (out []AddCommentsResult, er
 		}
 	}
 
-	sort.Slice(out, func(i, j int) bool { return out[i].Pos > out[j].Pos })
+	for _, stub := range stubs {
+		text, err := tt.Execute(stub.data)
+		if err != nil {
+			return nil, err
+		}
+		if text == "" {
+			continue
+		}
+		p := fset.Position(stub.pos)
+		out = append(out, TextEdit{
+			File:    p.Filename,
+			Start:   p.Offset,
+			End:     p.Offset,
+			NewText: indentComment(text, src, p.Offset),
+		})
+	}
 
-	if isRuneCount {
-		bs, err := ioutil.ReadFile(filename)
+	if opt.All {
+		edit, err := packageDocEdit(filename, fset, file, tt)
 		if err != nil {
-			return nil, errors.Wrap(err, "error on read file")
+			return nil, err
 		}
-		for i, p := range out {
-			out[i].Pos = utf8.RuneCount(bs[:p.Pos])
+		if edit != nil {
+			out = append(out, *edit)
 		}
 	}
 
+	SortEdits(out)
+
 	// log.Printf("out: %v", out)
 	// log.Printf("----------------------OK----------------------")
 	return
 }
 
-func appendDoc(out []AddCommentsResult, name *ast.Ident, doc *ast.CommentGroup, pos token.Pos) []AddCommentsResult {
-	if !name.IsExported() {
-		return out
+// commentStub - declaration without doc comment and position of its comment
+type commentStub struct {
+	data CommentData
+	pos  token.Pos
+}
+
+func appendStub(stubs []commentStub, data CommentData, exported bool, doc *ast.CommentGroup, pos token.Pos) []commentStub {
+	if !exported {
+		return stubs
 	}
 	if !docIsEmpty(doc) {
-		return out
+		return stubs
+	}
+	return append(stubs, commentStub{data: data, pos: pos})
+}
+
+// appendMemberStubs - stubs of exported fields of struct and of methods of interface,
+// embedded ones and ones with comment at the end of line are skipped
+func appendMemberStubs(stubs []commentStub, s *ast.TypeSpec) []commentStub {
+	var fields *ast.FieldList
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		fields = t.Fields
+	case *ast.InterfaceType:
+		fields = t.Methods
+	default:
+		return stubs
+	}
+	for _, f := range fields.List {
+		if len(f.Names) == 0 || !docIsEmpty(f.Comment) {
+			continue
+		}
+		stubs = appendStub(stubs, memberCommentData(s.Name.Name, f), anyExported(f.Names), f.Doc, f.Pos())
+	}
+	return stubs
+}
+
+func anyExported(names []*ast.Ident) bool {
+	for _, id := range names {
+		if id.IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+// indentComment - comment inserted at offset of src with indent of its line,
+// so the next line keeps its indent
+func indentComment(text string, src []byte, offset int) string {
+	return strings.Replace(text, "\n", "\n"+lineIndent(src, offset), -1)
+}
+
+// lineIndent - spaces before offset in its line, "" if there is other text before it
+func lineIndent(src []byte, offset int) string {
+	start := strings.LastIndexByte(string(src[:offset]), '\n') + 1
+	indent := string(src[start:offset])
+	if strings.TrimSpace(indent) != "" {
+		return ""
+	}
+	return indent
+}
+
+// packageDocEdit - edit which adds package comment into doc.go of dir of file
+// if no file of package has it, nil otherwise
+func packageDocEdit(filename string, fset *token.FileSet, file *ast.File, tt CommentTemplates) (*TextEdit, error) {
+	if !docIsEmpty(file.Doc) {
+		return nil, nil
+	}
+	text, err := tt.Execute(CommentData{Kind: CommentPackage, Name: file.Name.Name})
+	if err != nil || text == "" {
+		return nil, err
+	}
+
+	dir := filepath.Dir(filename)
+	docFile := filepath.Join(dir, "doc.go")
+	edit := &TextEdit{File: docFile, NewText: text + "package " + file.Name.Name + "\n"}
+	if filepath.Clean(filename) == docFile {
+		edit = &TextEdit{File: docFile, NewText: text}
+		edit.Start = fset.Position(file.Package).Offset
+		edit.End = edit.Start
+	}
+
+	files, err := goFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		other := filepath.Join(dir, f)
+		if strings.HasSuffix(f, "_test.go") || other == filepath.Clean(filename) {
+			continue
+		}
+		src, err := ReadFile(other, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on read file")
+		}
+		of, _ := parser.ParseFile(fset, other, src, parser.PackageClauseOnly|parser.ParseComments)
+		if of == nil || of.Name.Name != file.Name.Name {
+			continue
+		}
+		if !docIsEmpty(of.Doc) {
+			return nil, nil
+		}
+		if other == docFile {
+			edit = &TextEdit{File: docFile, NewText: text}
+			edit.Start = fset.Position(of.Package).Offset
+			edit.End = edit.Start
+		}
 	}
-	out = append(out, AddCommentsResult{
-		Pos:  int(pos) - 1,
-		Text: fmt.Sprintf("// %s ...\n", name),
-	})
-	return out
+	return edit, nil
 }
 
 func docIsEmpty(doc *ast.CommentGroup) bool {
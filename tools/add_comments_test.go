@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestAddComments(t *testing.T) {
+	filename := "./testdata/test_add_comments.go"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+	golden, err := ioutil.ReadFile(filename + ".golden")
+	if err != nil {
+		t.Fatalf("Error on read golden file: %v", err)
+	}
+
+	edits, err := AddComments(filename, nil)
+	if err != nil {
+		t.Fatalf("Error on add comments: %v", err)
+	}
+	result, err := ApplyEdits(src, edits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	if string(result) != string(golden) {
+		t.Errorf("Result: %s", result)
+		t.Errorf("Expect: %s", golden)
+	}
+}
+
+func TestAddCommentsCheckComments(t *testing.T) {
+	filename := "./testdata/test_add_comments.go"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+
+	edits, err := AddComments(filename, nil)
+	if err != nil {
+		t.Fatalf("Error on add comments: %v", err)
+	}
+	result, err := ApplyEdits(src, edits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	// added comments are not reported by check
+	problems, err := CheckComments(filename, result)
+	if err != nil {
+		t.Fatalf("Error on check comments: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("Problems of added comments: %v", problems)
+	}
+}
+
+func TestAddCommentsConfig(t *testing.T) {
+	filename := "./testdata/comments/comments.go"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+
+	// "func" is set by config, "method" by argument, "struct" is disabled by config
+	edits, err := AddCommentsWith(filename, nil, CommentOptions{
+		Templates: CommentTemplates{CommentMethod: "{{.Name}} of {{.Recv}}"},
+	})
+	if err != nil {
+		t.Fatalf("Error on add comments: %v", err)
+	}
+	result, err := ApplyEdits(src, edits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	expect := "package comments\n\ntype Server struct{}\n\n// ListenAndServe of *Server\nfunc (s *Server) ListenAndServe() {}\n\n// RunAll - run all\nfunc RunAll() {}\n"
+	if string(result) != expect {
+		t.Errorf("Result: %q", result)
+		t.Errorf("Expect: %q", expect)
+	}
+}
+
+func TestAddCommentsAll(t *testing.T) {
+	filename := "./testdata/test_all_add_comments.go"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+	golden, err := ioutil.ReadFile(filename + ".golden")
+	if err != nil {
+		t.Fatalf("Error on read golden file: %v", err)
+	}
+
+	edits, err := AddCommentsWith(filename, nil, CommentOptions{All: true})
+	if err != nil {
+		t.Fatalf("Error on add comments: %v", err)
+	}
+
+	// package comment is added by new doc.go
+	var fileEdits []TextEdit
+	var docEdits []TextEdit
+	for _, e := range edits {
+		if e.File == filename {
+			fileEdits = append(fileEdits, e)
+		} else {
+			docEdits = append(docEdits, e)
+		}
+	}
+	expectDoc := []TextEdit{{File: "testdata/doc.go", NewText: "// Package test provides test.\npackage test\n"}}
+	if !reflect.DeepEqual(docEdits, expectDoc) {
+		t.Errorf("Wrong edits of doc.go: %v", docEdits)
+	}
+
+	result, err := ApplyEdits(src, fileEdits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	if string(result) != string(golden) {
+		t.Errorf("Result: %s", result)
+		t.Errorf("Expect: %s", golden)
+	}
+}
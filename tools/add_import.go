@@ -1,113 +1,135 @@
 package tools
 
 import (
-	"bytes"
-	"go/ast"
-	"go/format"
+	"fmt"
 	"go/parser"
 	"go/token"
-	"os"
-	"strconv"
-	"strings"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 )
 
-// AddImportResult - result of add_import command
-type AddImportResult struct {
-	// L/Rpos - position on original file
-	// it means old import block declaration
-	Lpos int64 `json:"l_pos"`
-	Rpos int64 `json:"r_pos"`
+// ImportConflictError - import can not be added because of existing import:
+// the same path with other name or other path with the same name
+type ImportConflictError struct {
+	Path string // requested import path
+	Name string // requested name, "" if name is not set
 
-	// Text for replace on original place with new import block
-	Text string `json:"text"`
+	ExistingPath string
+	ExistingName string
+}
+
+func (e *ImportConflictError) Error() string {
+	if e.Path == e.ExistingPath {
+		if e.ExistingName == "" {
+			return fmt.Sprintf("%q is already imported without name", e.Path)
+		}
+		return fmt.Sprintf("%q is already imported as %s", e.Path, e.ExistingName)
+	}
+	return fmt.Sprintf("name of %q is already used by import of %q", e.Path, e.ExistingPath)
+}
+
+// Import - import path with optional name:
+// alias, "_" for blank import or "." for dot import
+type Import struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path"`
 }
 
 // AddImport - add import to go source file
-func AddImport(filename string, importName string) (*AddImportResult, error) {
-	fl, err := os.OpenFile(filename, os.O_RDONLY, 0600)
+// Result is the edit which replaces old import block with new one.
+// If src != nil, it is used as content of file (see ReadFile).
+func AddImport(filename string, importName string, src []byte) ([]TextEdit, error) {
+	return AddNamedImport(filename, "", importName, src)
+}
+
+// AddNamedImport - add import with name to go source file:
+// alias, "_" for blank import or "." for dot import ("" - without name)
+// *ImportConflictError is returned if the import conflicts with existing one.
+func AddNamedImport(filename string, name, importName string, src []byte) ([]TextEdit, error) {
+	return AddImports(filename, []Import{{Name: name, Path: importName}}, src)
+}
+
+// AddImports - add imports to go source file
+// Result is the single edit which replaces all old import declarations
+// with one block grouped into standard library, third-party and local imports,
+// so all imports are added by one edit. Comments of imports are kept,
+// declarations `import "C"` with cgo preamble stay separate.
+// *ImportConflictError is returned if an import conflicts with existing one.
+func AddImports(filename string, imports []Import, src []byte) ([]TextEdit, error) {
+	src, err := ReadFile(filename, src)
 	if err != nil {
-		return nil, errors.Wrap(err, "error on open file")
+		return nil, errors.Wrap(err, "error on read file")
 	}
-	defer fl.Close()
 
 	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, filename, fl, parser.ImportsOnly)
+	file, err := parser.ParseFile(fset, filename, src, parser.ImportsOnly|parser.ParseComments)
 	if err != nil {
 		return nil, errors.Wrap(err, "error on parse file")
 	}
 
-	oldImport := getImportDecl(file)
-
-	var res = &AddImportResult{}
-
-	imp := addImportAst(importName, file)
-	ast.SortImports(fset, file)
-
-	var bs bytes.Buffer
-	err = format.Node(&bs, fset, imp)
+	b := parseImportBlock(fset, file, src)
+	err = resolveNames(b.Lines, filepath.Dir(filename))
 	if err != nil {
-		return nil, errors.Wrap(err, "error on format import to string")
+		return nil, err
+	}
+	var paths []string
+	for _, imp := range imports {
+		if imp.Name == "" {
+			paths = append(paths, imp.Path)
+		}
+	}
+	names, err := packageNames(filepath.Dir(filename), paths)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on find names of packages")
 	}
 
-	res.Text = bs.String()
-
-	// make border of old import block
-	if oldImport == nil {
-		res.Lpos = int64(file.Name.End())
-		res.Rpos = int64(file.Name.End())
-		res.Text = "\n" + res.Text + "\n"
-	} else {
-		res.Lpos = int64(oldImport.Pos() - 1)
-		res.Rpos = int64(oldImport.End() - 1)
+	for _, imp := range imports {
+		if imp.Path == "C" {
+			return nil, errors.New(`import "C" needs cgo preamble, it can not be added`)
+		}
+		exists, err := existingImport(b.Lines, imp.Name, imp.Path, names[imp.Path])
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			continue
+		}
+		b.add(imp.Name, imp.Path, names[imp.Path])
+	}
+	if len(b.Lines) == 0 {
+		return []TextEdit{}, nil
 	}
 
-	return res, nil
+	local, err := localPrefix(filename)
+	if err != nil {
+		return nil, err
+	}
+	return []TextEdit{b.edit(filename, src, local)}, nil
 }
 
-func addImportAst(importName string, file *ast.File) *ast.GenDecl {
-	importSpec := &ast.ImportSpec{
-		Path: &ast.BasicLit{
-			Value: strconv.Quote(importName)},
+// existingImport - path is already imported with name by one of lines,
+// error if the import conflicts with existing one
+// pkgName is the real name of package, "" if it is unknown.
+func existingImport(lines []importLine, name, importPath, pkgName string) (bool, error) {
+	newName := name
+	switch {
+	case newName == "" && pkgName != "":
+		newName = pkgName
+	case newName == "":
+		newName = assumedPackageName(importPath)
 	}
 
-	for _, d := range file.Decls {
-		switch d := d.(type) {
-		case *ast.GenDecl:
-			if d.Tok == token.IMPORT {
-				// for case is `import "fmt"`
-				// needs set not zero Lparen
-				if len(d.Specs) == 1 && d.Lparen == 0 {
-					d.Lparen = d.Specs[0].Pos()
-				}
-
-				// skip if import already exists
-				for _, s := range d.Specs {
-					if is, ok := s.(*ast.ImportSpec); ok {
-						if is.Path.Value == importSpec.Path.Value {
-							return d
-						}
-					}
-				}
-
-				if strings.ContainsRune(importName, '.') {
-					// importSpec.Path.ValuePos = d.Specs[len(d.Specs)-1].Pos() + 1
-					d.Specs = append(d.Specs, importSpec)
-
-				} else {
-					d.Specs = append([]ast.Spec{importSpec}, d.Specs...)
-				}
-
-				return d
-			}
+	for _, l := range lines {
+		switch {
+		case l.Path == importPath && (newName == l.name() || name == "_"):
+			// side effects of package are already imported by any import
+			return true, nil
+		case l.Path == importPath:
+			return false, &ImportConflictError{Path: importPath, Name: name, ExistingPath: l.Path, ExistingName: l.Name}
+		case newName != "_" && newName != "." && newName == l.name():
+			return false, &ImportConflictError{Path: importPath, Name: name, ExistingPath: l.Path, ExistingName: l.Name}
 		}
 	}
-	d := &ast.GenDecl{
-		Tok: token.IMPORT,
-		// TokPos: file.Name.End(),
-		Specs: []ast.Spec{importSpec},
-	}
-	file.Decls = append([]ast.Decl{d}, file.Decls...)
-	return d
+	return false, nil
 }
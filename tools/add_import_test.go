@@ -3,7 +3,6 @@ package tools
 import (
 	"bytes"
 	"io/ioutil"
-	"os"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -18,6 +17,8 @@ func TestAddImport(t *testing.T) {
 		{"One import decl", "test_one_add_import.go"},
 		{"Many import decl", "test_many_add_import.go"},
 		{"Many with error import decl", "test_many_with_error_add_import.go"},
+		{"Comments and cgo", "test_comments_add_import.go"},
+		{"Cgo between decls", "test_cgo_inside_add_import.go"},
 	} {
 		t.Run(tt.Name, func(t *testing.T) {
 			testAddImport(t, tt.Filename)
@@ -64,40 +65,145 @@ func testAddImport(t *testing.T, filename string) {
 	}
 }
 
-func addImportToFile(filename string, importName string, prevBs []byte) error { // nolint: gocyclo
-	res, err := AddImport(filename, importName)
+func addImportToFile(filename string, importName string, prevBs []byte) error {
+	res, err := AddImport(filename, importName, nil)
 	if err != nil {
 		return errors.Wrap(err, "error on add import")
 	}
 
-	out, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC, 0600)
+	resultBs, err := ApplyEdits(prevBs, res)
 	if err != nil {
-		return errors.Wrap(err, "error on create temp file")
+		return errors.Wrap(err, "error on apply edits")
 	}
 
-	n, err := out.Write(prevBs[:res.Lpos])
+	err = ioutil.WriteFile(filename, resultBs, 0600)
 	if err != nil {
-		return errors.Wrap(err, "error on copy first part")
+		return errors.Wrap(err, "error on write result file")
 	}
 
-	if n != int(res.Lpos) {
-		return errors.New("wrong copied bytes")
-	}
+	return nil
+}
 
-	_, err = out.WriteString(res.Text)
-	if err != nil {
-		return errors.Wrap(err, "error on write text of new import block")
+func TestAddNamedImport(t *testing.T) {
+	src := []byte("package test\n\nimport (\n\t\"fmt\"\n\n\tyaml \"gopkg.in/yaml.v2\"\n)\n")
+	for _, tt := range []struct {
+		Name, Import string
+		Expect       string
+		Conflict     bool
+	}{
+		{"_", "image/png", "package test\n\nimport (\n\t\"fmt\"\n\t_ \"image/png\"\n\n\tyaml \"gopkg.in/yaml.v2\"\n)\n", false},
+		{".", "strings", "package test\n\nimport (\n\t\"fmt\"\n\t. \"strings\"\n\n\tyaml \"gopkg.in/yaml.v2\"\n)\n", false},
+		{"yaml3", "gopkg.in/yaml.v3", "package test\n\nimport (\n\t\"fmt\"\n\n\tyaml \"gopkg.in/yaml.v2\"\n\tyaml3 \"gopkg.in/yaml.v3\"\n)\n", false},
+		{"", "gopkg.in/yaml.v2", string(src), false},
+		{"_", "fmt", string(src), false},
+		{"f", "fmt", "", true},
+		{"yaml", "gopkg.in/yaml.v3", "", true},
+		{"", "github.com/other/fmt", "", true},
+	} {
+		t.Run(tt.Name+" "+tt.Import, func(t *testing.T) {
+			res, err := AddNamedImport("./testdata/unknown.go", tt.Name, tt.Import, src)
+			if tt.Conflict {
+				if _, ok := errors.Cause(err).(*ImportConflictError); !ok {
+					t.Fatalf("Expect conflict error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error on add import: %v", err)
+			}
+			result, err := ApplyEdits(src, res)
+			if err != nil {
+				t.Fatalf("Error on apply edits: %v", err)
+			}
+			if string(result) != tt.Expect {
+				t.Errorf("Result: %q", result)
+				t.Errorf("Expect: %q", tt.Expect)
+			}
+		})
 	}
+}
 
-	_, err = out.Write(prevBs[res.Rpos:])
-	if err != nil {
-		return errors.Wrap(err, "error on copy file")
+func TestAddImports(t *testing.T) {
+	for _, tt := range []struct {
+		Name    string
+		Src     string
+		Imports []Import
+		Expect  string
+	}{
+		{
+			// declarations are merged into one grouped block
+			"into groups",
+			"package test\n\nimport \"fmt\"\n\nimport (\n\t\"os\"\n\n\t\"github.com/pkg/errors\"\n)\n\nfunc f() {}\n",
+			[]Import{{Path: "bytes"}, {Path: "github.com/a/b"}, {Path: "fmt"}},
+			"package test\n\nimport (\n\t\"bytes\"\n\t\"fmt\"\n\t\"os\"\n\n\t\"github.com/a/b\"\n\t\"github.com/pkg/errors\"\n)\n\nfunc f() {}\n",
+		},
+		{
+			"new group",
+			"package test\n\nimport (\n\t\"os\" // os\n)\n",
+			[]Import{{Path: "github.com/a/b"}},
+			"package test\n\nimport (\n\t\"os\" // os\n\n\t\"github.com/a/b\"\n)\n",
+		},
+		{
+			"new declaration",
+			"package test\n\nfunc f() {}\n",
+			[]Import{{Path: "os"}, {Path: "github.com/a/b"}, {Path: "bytes"}},
+			"package test\n\nimport (\n\t\"bytes\"\n\t\"os\"\n\n\t\"github.com/a/b\"\n)\n\nfunc f() {}\n",
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			src := []byte(tt.Src)
+			res, err := AddImports("./testdata/unknown.go", tt.Imports, src)
+			if err != nil {
+				t.Fatalf("Error on add imports: %v", err)
+			}
+			if len(res) != 1 {
+				t.Fatalf("Expect one edit: %v", res)
+			}
+			result, err := ApplyEdits(src, res)
+			if err != nil {
+				t.Fatalf("Error on apply edits: %v", err)
+			}
+			if string(result) != tt.Expect {
+				t.Errorf("Result: %q", result)
+				t.Errorf("Expect: %q", tt.Expect)
+			}
+		})
 	}
+}
 
-	err = out.Close()
-	if err != nil {
-		return errors.Wrap(err, "error on close to read")
+func TestAddImportPackageNames(t *testing.T) {
+	for _, tt := range []struct {
+		Name     string
+		Existing string
+		Import   string
+		Conflict bool
+	}{
+		// both packages are named v1
+		{"versioned paths", "k8s.io/api/core/v1", "k8s.io/api/apps/v1", true},
+		// package of x/client is named api
+		{"name differs from path", "example.com/names/x/client", "example.com/names/y/client", false},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			src := []byte("package names\n\nimport \"" + tt.Existing + "\"\n")
+			res, err := AddImport("./testdata/names/names.go", tt.Import, src)
+			if tt.Conflict {
+				if _, ok := errors.Cause(err).(*ImportConflictError); !ok {
+					t.Fatalf("Expect conflict error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error on add import: %v", err)
+			}
+			result, err := ApplyEdits(src, res)
+			if err != nil {
+				t.Fatalf("Error on apply edits: %v", err)
+			}
+			expect := "package names\n\nimport (\n\t\"" + tt.Existing + "\"\n\t\"" + tt.Import + "\"\n)\n"
+			if string(result) != expect {
+				t.Errorf("Result: %q", result)
+				t.Errorf("Expect: %q", expect)
+			}
+		})
 	}
-
-	return nil
 }
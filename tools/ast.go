@@ -3,16 +3,43 @@ package tools
 import (
 	"go/ast"
 	"go/token"
+	"path/filepath"
+
+	"github.com/pkg/errors"
 )
 
-func getImportDecl(file *ast.File) *ast.GenDecl {
+// getImportDecls - all import declarations of file
+func getImportDecls(file *ast.File) []*ast.GenDecl {
+	var decls []*ast.GenDecl
 	for _, d := range file.Decls {
 		switch d := d.(type) {
 		case *ast.GenDecl:
 			if d.Tok == token.IMPORT {
-				return d
+				decls = append(decls, d)
 			}
 		}
 	}
-	return nil
+	return decls
+}
+
+// importsRange - byte offsets of import declarations of file:
+// from the first to the last one or the end of package name if there are no imports
+func importsRange(fset *token.FileSet, file *ast.File, decls []*ast.GenDecl) (start, end int) {
+	if len(decls) == 0 {
+		start = fset.Position(file.Name.End()).Offset
+		return start, start
+	}
+	return fset.Position(decls[0].Pos()).Offset, fset.Position(decls[len(decls)-1].End()).Offset
+}
+
+// localPrefix - module path of file, it is prefix of local imports
+func localPrefix(filename string) (string, error) {
+	m, err := FindModule(filepath.Dir(filename))
+	if err != nil {
+		return "", errors.Wrap(err, "error on find module")
+	}
+	if m == nil {
+		return "", nil
+	}
+	return m.Path(), nil
 }
@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"bytes"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// NewBuildContext - build.Default with goos, goarch and tags ("" - default),
+// files are read through DefaultOverlay
+func NewBuildContext(goos, goarch string, tags []string) *build.Context {
+	bctx := build.Default
+	if goos != "" {
+		bctx.GOOS = goos
+	}
+	if goarch != "" {
+		bctx.GOARCH = goarch
+	}
+	if tags != nil {
+		bctx.BuildTags = tags
+	}
+	bctx.OpenFile = func(path string) (io.ReadCloser, error) {
+		bs, err := ReadFile(path, nil)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(bs)), nil
+	}
+	return &bctx
+}
+
+// buildKey - key of build context for caches of matched files
+func buildKey(bctx *build.Context) string {
+	return bctx.GOOS + "/" + bctx.GOARCH + "/" + strings.Join(bctx.BuildTags, ",") + "/" + strings.Join(bctx.ReleaseTags, ",")
+}
+
+// loadBuildFunc - name of package in dir and its files matched by build constraints
+type loadBuildFunc func(dir string, files []string) (name string, matched []string, err error)
+
+// withBuild - skip packages without files matched by build constraints,
+// fill name of package, its matched files and isMain
+func withBuild(load loadBuildFunc) importFuncOverride {
+	return func(fn importFunc) importFunc {
+		return func(i importPath) {
+			name, matched, err := load(i.path, i.files)
+			if err != nil || len(matched) == 0 {
+				return
+			}
+			i.name, i.files = name, matched
+			i.isMain = name == "main"
+			fn(i)
+		}
+	}
+}
+
+// matchPackage - files of dir matched by build constraints of bctx and
+// name of package of them: the most common one, "documentation" is ignored
+func matchPackage(bctx *build.Context, dir string, files []string) (string, []string, error) {
+	fset := token.NewFileSet()
+	names := make(map[string]int)
+	var name string
+	var matched []string
+	for _, f := range files {
+		ok, err := bctx.MatchFile(dir, f)
+		if err != nil || !ok {
+			continue
+		}
+		filename := filepath.Join(dir, f)
+		src, err := ReadFile(filename, nil)
+		if err != nil {
+			return "", nil, err
+		}
+		file, err := parser.ParseFile(fset, filename, src, parser.PackageClauseOnly)
+		if err != nil || file.Name.Name == "documentation" {
+			continue
+		}
+		matched = append(matched, f)
+
+		names[file.Name.Name]++
+		if names[file.Name.Name] > names[name] {
+			name = file.Name.Name
+		}
+	}
+	return name, matched, nil
+}
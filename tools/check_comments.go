@@ -0,0 +1,306 @@
+package tools
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of CommentProblem
+const (
+	// ProblemNamePrefix - doc comment of exported declaration does not start with its name
+	ProblemNamePrefix = "name_prefix"
+	// ProblemUnexportedReceiver - method of unexported type has doc comment,
+	// which is not shown in documentation
+	ProblemUnexportedReceiver = "unexported_receiver"
+	// ProblemDeprecated - "Deprecated:" is not at the start of its own paragraph
+	// or it is written in wrong case or without colon
+	ProblemDeprecated = "deprecated"
+)
+
+// CommentProblem - problem of doc comment with edits which fix it
+type CommentProblem struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"` // name of declaration
+	Message string `json:"message"`
+
+	// File, Line, Column - position of comment
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+
+	// Edits - suggested fix, sorted by position descending
+	Edits []TextEdit `json:"edits"`
+}
+
+// CheckComments - problems of doc comments of declarations in file
+// Only line comments are checked, /* */ ones are skipped.
+func CheckComments(filename string, src []byte) ([]CommentProblem, error) {
+	src, err := ReadFile(filename, src)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read file")
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on parse file")
+	}
+
+	c := commentChecker{fset: fset, src: src, out: []CommentProblem{}}
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if hasUnexportedReceiver(d) {
+				c.unexportedReceiver(d)
+				continue
+			}
+			c.check(d.Name, d.Doc)
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			// doc of single spec is doc of declaration
+			for _, s := range d.Specs {
+				doc := d.Doc
+				if len(d.Specs) != 1 || docIsEmpty(doc) {
+					doc = specDoc(s)
+				}
+				switch s := s.(type) {
+				case *ast.TypeSpec:
+					c.check(s.Name, doc)
+				case *ast.ValueSpec:
+					if len(s.Names) == 1 {
+						c.check(s.Names[0], doc)
+					}
+				}
+			}
+		}
+	}
+	return c.out, nil
+}
+
+func specDoc(s ast.Spec) *ast.CommentGroup {
+	switch s := s.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	}
+	return nil
+}
+
+// hasUnexportedReceiver - d is method of unexported type,
+// its doc is not shown in documentation
+func hasUnexportedReceiver(d *ast.FuncDecl) bool {
+	return d.Recv != nil && len(d.Recv.List) > 0 && !ast.IsExported(receiverName(d.Recv.List[0].Type))
+}
+
+// receiverName - name of type of receiver without pointer and type parameters
+func receiverName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+type commentChecker struct {
+	fset *token.FileSet
+	src  []byte
+	out  []CommentProblem
+}
+
+func (c *commentChecker) add(kind string, name *ast.Ident, pos token.Pos, msg string, edits ...TextEdit) {
+	p := c.fset.Position(pos)
+	for i := range edits {
+		edits[i].File = p.Filename
+	}
+	SortEdits(edits)
+	c.out = append(c.out, CommentProblem{
+		Kind:    kind,
+		Name:    name.Name,
+		Message: msg,
+		File:    p.Filename,
+		Line:    p.Line,
+		Column:  p.Column,
+		Edits:   edits,
+	})
+}
+
+func (c *commentChecker) offset(pos token.Pos) int {
+	return c.fset.Position(pos).Offset
+}
+
+// unexportedReceiver - doc of method of unexported type is removed by suggested edit
+func (c *commentChecker) unexportedReceiver(d *ast.FuncDecl) {
+	if docIsEmpty(d.Doc) || !d.Name.IsExported() {
+		return
+	}
+	c.add(ProblemUnexportedReceiver, d.Name, d.Doc.Pos(),
+		"comment of method "+d.Name.Name+" of unexported type is not shown in documentation",
+		TextEdit{Start: c.offset(d.Doc.Pos()), End: c.offset(d.Pos())})
+}
+
+// check - doc of exported name starts with it, "Deprecated:" has its own paragraph
+func (c *commentChecker) check(name *ast.Ident, doc *ast.CommentGroup) {
+	if docIsEmpty(doc) {
+		return
+	}
+	lines := docLines(doc)
+	if len(lines) == 0 {
+		return
+	}
+
+	// comment of deprecated declaration may start with "Deprecated:"
+	first := lines[0]
+	if m := reDeprecated.FindStringIndex(first.text); name.IsExported() && (m == nil || m[0] > 0) {
+		if edit, ok := c.namePrefix(name.Name, first); !ok {
+			c.add(ProblemNamePrefix, name, first.comment.Pos(),
+				"comment of "+name.Name+" should start with its name", edit)
+		}
+	}
+
+	for i, l := range lines {
+		if edits, ok := c.deprecated(l, i == 0 || lines[i-1].text == ""); !ok {
+			c.add(ProblemDeprecated, name, l.comment.Pos(),
+				`"Deprecated:" should start its own paragraph of comment of `+name.Name, edits...)
+		}
+	}
+}
+
+// docLine - text of line comment without "//" and the first space
+type docLine struct {
+	comment *ast.Comment
+	text    string
+	offset  int // offset of text in comment
+}
+
+// docLines - lines of line comments of doc, directives (//go:generate) are skipped
+func docLines(doc *ast.CommentGroup) []docLine {
+	var out []docLine
+	for _, cm := range doc.List {
+		if !strings.HasPrefix(cm.Text, "//") || isDirective(cm.Text) {
+			continue
+		}
+		text := strings.TrimPrefix(cm.Text, "//")
+		skip := 2
+		if strings.HasPrefix(text, " ") {
+			text, skip = text[1:], 3
+		}
+		out = append(out, docLine{comment: cm, text: text, offset: skip})
+	}
+	return out
+}
+
+// isDirective - comment is directive for tools like //go:generate or //nolint
+func isDirective(text string) bool {
+	text = strings.TrimPrefix(text, "//")
+	i := strings.IndexByte(text, ':')
+	return len(text) > 0 && text[0] != ' ' && i > 0 && !strings.ContainsAny(text[:i], " \t")
+}
+
+// namePrefix - line starts with name ("A", "An" or "The" are allowed before it),
+// otherwise edit which replaces the first identifier with name or inserts name
+func (c *commentChecker) namePrefix(name string, l docLine) (TextEdit, bool) {
+	words := strings.Fields(l.text)
+	switch {
+	case len(words) > 0 && strings.TrimRight(words[0], ".,:") == name:
+		return TextEdit{}, true
+	case len(words) > 1 && (words[0] == "A" || words[0] == "An" || words[0] == "The") && words[1] == name:
+		return TextEdit{}, true
+	}
+
+	start := c.offset(l.comment.Pos()) + l.offset
+	if len(words) == 0 {
+		return TextEdit{Start: start, End: start, NewText: name}, false
+	}
+	start += strings.Index(l.text, words[0])
+	word := strings.TrimRight(words[0], ".,:")
+	rs := []rune(word)
+	switch {
+	case isIdent(word) && (strings.EqualFold(word, name) || hasInnerUpper(word)):
+		// comment of renamed declaration
+		return TextEdit{Start: start, End: start + len(word), NewText: name}, false
+	case len(rs) > 1 && unicode.IsUpper(rs[0]) && !hasInnerUpper(word):
+		// capitalized word continues sentence after name
+		return TextEdit{Start: start, End: start + len(string(rs[0])), NewText: name + " " + strings.ToLower(string(rs[0]))}, false
+	}
+	return TextEdit{Start: start, End: start, NewText: name + " "}, false
+}
+
+// hasInnerUpper - word has upper case letter after the first one, like "OldName"
+func hasInnerUpper(word string) bool {
+	for i, r := range word {
+		if i > 0 && unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+var reDeprecated = regexp.MustCompile(`(?i)\bdeprecated\b\s*:?[ \t]*`)
+
+// deprecated - line with "Deprecated:" is correct: it starts paragraph with
+// "Deprecated: ", otherwise edits which fix it
+func (c *commentChecker) deprecated(l docLine, paragraph bool) ([]TextEdit, bool) {
+	m := reDeprecated.FindStringIndex(l.text)
+	if m == nil {
+		return nil, true
+	}
+	match := l.text[m[0]:m[1]]
+	if m[0] > 0 && !strings.Contains(match, ":") {
+		// word "deprecated" inside of sentence
+		return nil, true
+	}
+	if m[0] == 0 && paragraph && strings.HasPrefix(match, "Deprecated: ") {
+		return nil, true
+	}
+
+	start := c.offset(l.comment.Pos())
+	indent := lineIndent(c.src, start)
+	textStart := start + l.offset
+	if m[0] > 0 {
+		// split line, so "Deprecated:" starts new paragraph
+		before := strings.TrimRight(l.text[:m[0]], " \t")
+		return []TextEdit{{
+			Start:   textStart + len(before),
+			End:     textStart + m[1],
+			NewText: "\n" + indent + "//\n" + indent + "// Deprecated: ",
+		}}, false
+	}
+
+	var edits []TextEdit
+	if match != "Deprecated: " {
+		edits = append(edits, TextEdit{Start: textStart, End: textStart + m[1], NewText: "Deprecated: "})
+	}
+	if !paragraph {
+		edits = append(edits, TextEdit{Start: start, End: start, NewText: "//\n" + indent})
+	}
+	return edits, false
+}
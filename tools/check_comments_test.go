@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestCheckComments(t *testing.T) {
+	filename := "./testdata/test_check_comments.go"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+	golden, err := ioutil.ReadFile(filename + ".golden")
+	if err != nil {
+		t.Fatalf("Error on read golden file: %v", err)
+	}
+
+	problems, err := CheckComments(filename, nil)
+	if err != nil {
+		t.Fatalf("Error on check comments: %v", err)
+	}
+	var found []string
+	var edits []TextEdit
+	for _, p := range problems {
+		found = append(found, p.Kind+" "+p.Name)
+		edits = append(edits, p.Edits...)
+	}
+	expect := []string{
+		"name_prefix NewName",
+		"name_prefix Value",
+		"name_prefix Size",
+		"unexported_receiver Method",
+		"deprecated Old",
+		"deprecated Older",
+		"deprecated Oldest",
+	}
+	if !reflect.DeepEqual(found, expect) {
+		t.Errorf("Result: %v", found)
+		t.Errorf("Expect: %v", expect)
+	}
+
+	// suggested edits fix all problems
+	SortEdits(edits)
+	result, err := ApplyEdits(src, edits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	if string(result) != string(golden) {
+		t.Errorf("Result: %s", result)
+		t.Errorf("Expect: %s", golden)
+	}
+	problems, err = CheckComments(filename, golden)
+	if err != nil {
+		t.Fatalf("Error on check comments: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("Unexpected problems of fixed file: %v", problems)
+	}
+}
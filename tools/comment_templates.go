@@ -0,0 +1,294 @@
+package tools
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// CommentKind - kind of declaration which has its own template of doc comment
+type CommentKind string
+
+// Kinds of declarations
+const (
+	CommentFunc        CommentKind = "func"
+	CommentMethod      CommentKind = "method"
+	CommentConstructor CommentKind = "constructor" // func NewX
+	CommentInterface   CommentKind = "interface"
+	CommentStruct      CommentKind = "struct"
+	CommentType        CommentKind = "type"  // other types
+	CommentError       CommentKind = "error" // var ErrX
+	CommentVar         CommentKind = "var"
+	CommentConst       CommentKind = "const"
+	CommentField       CommentKind = "field"
+	CommentIfaceMethod CommentKind = "interface_method"
+	CommentPackage     CommentKind = "package"
+)
+
+// CommentTemplates - text/template of doc comment by kind of declaration,
+// executed with CommentData
+// Each line of result is prefixed with "// ", empty result means no comment.
+// Functions of templates: list ("a, b and c"), join, lower and words
+// ("ErrNotFound" - "err not found").
+type CommentTemplates map[CommentKind]string
+
+const funcCommentTemplate = `{{.Name}}` +
+	`{{with .Params}} accepts {{list .}}{{end}}` +
+	`{{if and .Params .Results}} and{{end}}` +
+	`{{with .Results}} returns {{list .}}{{end}}` +
+	`{{if not (or .Params .Results)}} has no parameters and results{{end}}.`
+
+// DefaultCommentTemplates - templates which are used for kinds missing in config
+var DefaultCommentTemplates = CommentTemplates{
+	CommentFunc:        funcCommentTemplate,
+	CommentMethod:      funcCommentTemplate,
+	CommentConstructor: `{{.Name}} returns a new {{.Type}}{{with .Params}} from {{list .}}{{end}}.`,
+	CommentInterface:   `{{.Name}} is an interface{{with .Methods}} of {{list .}}{{end}}.`,
+	CommentStruct:      `{{.Name}} is a structure{{with .Fields}} of {{list .}}{{end}}.`,
+	CommentType:        `{{.Name}} is a {{.Type}}.`,
+	CommentError:       `{{.Name}} is returned when {{.Message}}.`,
+	CommentVar:         `{{list .Names}} {{if eq (len .Names) 1}}is a variable{{else}}are variables{{end}}{{with .Type}} of type {{.}}{{end}}.`,
+	CommentConst:       `{{list .Names}} {{if eq (len .Names) 1}}is a constant{{else}}are constants{{end}}{{with .Type}} of type {{.}}{{end}}.`,
+	CommentField:       `{{list .Names}} of {{.Parent}}.`,
+	CommentIfaceMethod: funcCommentTemplate,
+	CommentPackage:     `Package {{.Name}} provides {{words .Name}}.`,
+}
+
+// CommentData - declaration described by doc comment
+type CommentData struct {
+	Kind CommentKind
+	Name string
+	// Names - all names of declaration with several names (e.g. var a, b int)
+	Names []string
+	// Recv - type of receiver of method
+	Recv string
+	// Parent - name of struct of field or of interface of method
+	Parent string
+	// Type - type of variable, constant or field if it is set, underlying type of type,
+	// type returned by constructor
+	Type string
+	// Params and Results - "name type" of parameters and results of function
+	Params, Results []string
+	// Fields and Methods - fields of struct and methods of interface
+	Fields, Methods []string
+	// Message - message of error variable created by errors.New or fmt.Errorf,
+	// words of its name without "Err" otherwise
+	Message string
+}
+
+var commentFuncs = template.FuncMap{
+	"list":  listWords,
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"words": func(s string) string { return strings.Join(splitWords(s), " ") },
+}
+
+// Merge - templates of tt with missing kinds taken from other
+func (tt CommentTemplates) Merge(other CommentTemplates) CommentTemplates {
+	out := make(CommentTemplates, len(tt)+len(other))
+	for k, t := range other {
+		out[k] = t
+	}
+	for k, t := range tt {
+		out[k] = t
+	}
+	return out
+}
+
+// Execute - text of doc comment of declaration with "// " prefixes and trailing "\n"
+func (tt CommentTemplates) Execute(d CommentData) (string, error) {
+	text, ok := tt[d.Kind]
+	if !ok {
+		text = DefaultCommentTemplates[d.Kind]
+	}
+	t, err := template.New(string(d.Kind)).Funcs(commentFuncs).Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "error on parse template of %s", d.Kind)
+	}
+	var b strings.Builder
+	err = t.Execute(&b, d)
+	if err != nil {
+		return "", errors.Wrapf(err, "error on execute template of %s", d.Kind)
+	}
+
+	comment := strings.TrimSpace(b.String())
+	if comment == "" {
+		return "", nil
+	}
+	var out strings.Builder
+	for _, line := range strings.Split(comment, "\n") {
+		out.WriteString(strings.TrimRight("// "+line, " ") + "\n")
+	}
+	return out.String(), nil
+}
+
+// listWords - words separated by comma and "and" before the last one
+func listWords(ss []string) string {
+	if len(ss) < 2 {
+		return strings.Join(ss, "")
+	}
+	return strings.Join(ss[:len(ss)-1], ", ") + " and " + ss[len(ss)-1]
+}
+
+// splitWords - lower case words of camel case name
+func splitWords(name string) []string {
+	var words []string
+	rs := []rune(name)
+	start := 0
+	for i := 1; i <= len(rs); i++ {
+		if i < len(rs) && !(unicode.IsUpper(rs[i]) && (unicode.IsLower(rs[i-1]) || i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+			continue
+		}
+		words = append(words, strings.ToLower(string(rs[start:i])))
+		start = i
+	}
+	return words
+}
+
+// funcCommentData - data of function or method
+func funcCommentData(d *ast.FuncDecl) CommentData {
+	c := CommentData{
+		Kind:    CommentFunc,
+		Name:    d.Name.Name,
+		Params:  fieldList(d.Type.Params),
+		Results: fieldList(d.Type.Results),
+	}
+	switch {
+	case d.Recv != nil && len(d.Recv.List) > 0:
+		c.Kind = CommentMethod
+		c.Recv = types.ExprString(d.Recv.List[0].Type)
+	case isConstructorName(c.Name) && d.Type.Results != nil && len(d.Type.Results.List) > 0:
+		c.Kind = CommentConstructor
+		typ := d.Type.Results.List[0].Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		c.Type = types.ExprString(typ)
+	}
+	return c
+}
+
+// isConstructorName - name is "New" or starts with "New" and upper case letter
+// (NewServer, but not Newline or News)
+func isConstructorName(name string) bool {
+	if name == "New" {
+		return true
+	}
+	if !strings.HasPrefix(name, "New") {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("New"):])
+	return unicode.IsUpper(r)
+}
+
+// typeCommentData - data of type
+func typeCommentData(s *ast.TypeSpec) CommentData {
+	c := CommentData{Kind: CommentType, Name: s.Name.Name, Type: types.ExprString(s.Type)}
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		c.Kind = CommentStruct
+		for _, f := range t.Fields.List {
+			c.Fields = append(c.Fields, fieldNames(f)...)
+		}
+	case *ast.InterfaceType:
+		c.Kind = CommentInterface
+		for _, f := range t.Methods.List {
+			c.Methods = append(c.Methods, fieldNames(f)...)
+		}
+	}
+	return c
+}
+
+// valueCommentData - data of variables or constants of spec
+func valueCommentData(tok token.Token, s *ast.ValueSpec) CommentData {
+	c := CommentData{Kind: CommentVar, Name: s.Names[0].Name}
+	for _, id := range s.Names {
+		c.Names = append(c.Names, id.Name)
+	}
+	if s.Type != nil {
+		c.Type = types.ExprString(s.Type)
+	}
+	switch {
+	case tok == token.CONST:
+		c.Kind = CommentConst
+	case len(s.Names) == 1 && strings.HasPrefix(c.Name, "Err"):
+		c.Kind = CommentError
+		c.Message = errorMessage(s, s.Names[0])
+	}
+	return c
+}
+
+// memberCommentData - data of named field of struct or method of interface parent
+func memberCommentData(parent string, f *ast.Field) CommentData {
+	c := CommentData{Kind: CommentField, Name: f.Names[0].Name, Parent: parent, Type: types.ExprString(f.Type)}
+	for _, id := range f.Names {
+		c.Names = append(c.Names, id.Name)
+	}
+	if ft, ok := f.Type.(*ast.FuncType); ok {
+		c.Kind, c.Type = CommentIfaceMethod, ""
+		c.Params, c.Results = fieldList(ft.Params), fieldList(ft.Results)
+	}
+	return c
+}
+
+// errorMessage - message of errors.New or fmt.Errorf which is value of name,
+// words of name without "Err" otherwise
+func errorMessage(s *ast.ValueSpec, name *ast.Ident) string {
+	for i, id := range s.Names {
+		if id != name || i >= len(s.Values) {
+			continue
+		}
+		call, ok := s.Values[i].(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			break
+		}
+		fn := types.ExprString(call.Fun)
+		if fn != "errors.New" && fn != "fmt.Errorf" {
+			break
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			if msg, err := strconv.Unquote(lit.Value); err == nil {
+				return msg
+			}
+		}
+	}
+	return strings.Join(splitWords(strings.TrimPrefix(name.Name, "Err")), " ")
+}
+
+// fieldList - "name type" of each name of fields, type only for unnamed ones
+func fieldList(fl *ast.FieldList) []string {
+	if fl == nil {
+		return nil
+	}
+	var out []string
+	for _, f := range fl.List {
+		typ := types.ExprString(f.Type)
+		if len(f.Names) == 0 {
+			out = append(out, typ)
+			continue
+		}
+		for _, id := range f.Names {
+			out = append(out, id.Name+" "+typ)
+		}
+	}
+	return out
+}
+
+// fieldNames - names of field, type for embedded one
+func fieldNames(f *ast.Field) []string {
+	if len(f.Names) == 0 {
+		return []string{types.ExprString(f.Type)}
+	}
+	var out []string
+	for _, id := range f.Names {
+		out = append(out, id.Name)
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigFile - name of file with settings of project
+const ConfigFile = ".golime.json"
+
+// Config - settings of project
+type Config struct {
+	// Comments - templates of doc comments stubs by kind of declaration
+	// (see CommentTemplates), missing kinds have default templates
+	Comments CommentTemplates `json:"comments"`
+}
+
+// FindConfig - find ConfigFile in dir or in its parents
+// It returns empty config without error if there is no such file.
+func FindConfig(dir string) (*Config, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on get abs path")
+	}
+	for {
+		bs, err := ReadFile(filepath.Join(dir, ConfigFile), nil)
+		if err == nil {
+			var c Config
+			err = json.Unmarshal(bs, &c)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error on parse %s", ConfigFile)
+			}
+			return &c, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "error on read %s", ConfigFile)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return &Config{}, nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// TextEdit - result of editing commands:
+// replace text of File between Start and End offsets with NewText
+type TextEdit struct {
+	File    string `json:"file"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	NewText string `json:"new_text"`
+}
+
+// Encoding - unit of offsets in TextEdit
+type Encoding string
+
+// Encodings of offsets
+const (
+	EncodingBytes Encoding = "bytes"
+	EncodingRunes Encoding = "runes"
+	EncodingUTF16 Encoding = "utf16"
+)
+
+// SortEdits - sort edits by Start descending,
+// so they can be applied one by one without shift of offsets
+func SortEdits(edits []TextEdit) {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Start > edits[j].Start })
+}
+
+// EncodeOffsets - convert byte offsets of edits of src into enc
+func EncodeOffsets(edits []TextEdit, src []byte, enc Encoding) error {
+	var count func([]byte) int
+	switch enc {
+	case "", EncodingBytes:
+		return nil
+	case EncodingRunes:
+		count = utf8.RuneCount
+	case EncodingUTF16:
+		count = utf16Count
+	default:
+		return errors.Errorf("unknown offset encoding: %q", enc)
+	}
+
+	for i, e := range edits {
+		if e.Start > len(src) || e.End > len(src) || e.Start > e.End {
+			return errors.Errorf("wrong edit offsets: %d-%d", e.Start, e.End)
+		}
+		edits[i].Start = count(src[:e.Start])
+		edits[i].End = edits[i].Start + count(src[e.Start:e.End])
+	}
+	return nil
+}
+
+// DecodeOffset - convert offset of src in enc into byte offset
+func DecodeOffset(src []byte, offset int, enc Encoding) (int, error) {
+	var size func(rune) int
+	switch enc {
+	case "", EncodingBytes:
+		return offset, nil
+	case EncodingRunes:
+		size = func(rune) int { return 1 }
+	case EncodingUTF16:
+		size = func(r rune) int { return len(utf16.Encode([]rune{r})) }
+	default:
+		return 0, errors.Errorf("unknown offset encoding: %q", enc)
+	}
+
+	var i, n int
+	for n < offset {
+		if i >= len(src) {
+			return 0, errors.Errorf("wrong offset: %d", offset)
+		}
+		r, l := utf8.DecodeRune(src[i:])
+		i += l
+		n += size(r)
+	}
+	return i, nil
+}
+
+func utf16Count(bs []byte) int {
+	var n int
+	for len(bs) > 0 {
+		r, size := utf8.DecodeRune(bs)
+		bs = bs[size:]
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// ApplyEdits - apply edits with byte offsets to src
+func ApplyEdits(src []byte, edits []TextEdit) ([]byte, error) {
+	edits = append([]TextEdit(nil), edits...)
+	SortEdits(edits)
+
+	out := append([]byte(nil), src...)
+	last := len(out)
+	for _, e := range edits {
+		if e.Start > e.End || e.End > last {
+			return nil, errors.Errorf("wrong or overlapped edit offsets: %d-%d", e.Start, e.End)
+		}
+		out = append(out[:e.Start], append([]byte(e.NewText), out[e.End:]...)...)
+		last = e.Start
+	}
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"testing"
+)
+
+func TestEncodeOffsets(t *testing.T) {
+	// "я" - 2 bytes, 1 rune, 1 utf16; "😀" - 4 bytes, 1 rune, 2 utf16
+	src := []byte("я😀abc")
+	for _, tt := range []struct {
+		Encoding   Encoding
+		Start, End int
+	}{
+		{EncodingBytes, 6, 8},
+		{EncodingRunes, 2, 4},
+		{EncodingUTF16, 3, 5},
+	} {
+		t.Run(string(tt.Encoding), func(t *testing.T) {
+			edits := []TextEdit{{Start: 6, End: 8}}
+			err := EncodeOffsets(edits, src, tt.Encoding)
+			if err != nil {
+				t.Fatalf("Error on encode offsets: %v", err)
+			}
+			if edits[0].Start != tt.Start || edits[0].End != tt.End {
+				t.Errorf("Result: %d-%d", edits[0].Start, edits[0].End)
+				t.Errorf("Expect: %d-%d", tt.Start, tt.End)
+			}
+		})
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	src := []byte("func A() {}\nfunc B() {}\n")
+	out, err := ApplyEdits(src, []TextEdit{
+		{Start: 0, End: 0, NewText: "// A ...\n"},
+		{Start: 12, End: 12, NewText: "// B ...\n"},
+	})
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	expect := "// A ...\nfunc A() {}\n// B ...\nfunc B() {}\n"
+	if string(out) != expect {
+		t.Errorf("Result: %q", out)
+		t.Errorf("Expect: %q", expect)
+	}
+}
@@ -6,33 +6,21 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
-	"go/build"
 	"go/format"
+	"go/importer"
 	"go/parser"
-	"go/printer"
 	"go/token"
+	"go/types"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"text/template"
+	"unicode"
 
+	"github.com/pkg/errors"
 	"golang.org/x/tools/imports"
 )
 
-const usage = `impl [-dir directory] <recv> <iface>
-
-impl generates method stubs for recv to implement iface.
-
-Examples:
-
-impl 'f *File' io.Reader
-impl Murmur hash.Hash
-impl -dir $GOPATH/src/github.com/josharian/impl Murmur hash.Hash
-
-Don't forget the single quotes around the receiver type
-to prevent shell globbing.
-`
-
 // findInterface returns the import path and identifier of an interface.
 // For example, given "http.ResponseWriter", findInterface returns
 // "net/http", "ResponseWriter".
@@ -76,7 +64,7 @@ func findInterface(iface string, srcDir string) (path string, id string, err err
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, srcPath, imp, 0)
 	if err != nil {
-		panic(err)
+		return "", "", fmt.Errorf("couldn't parse interface: %s", iface)
 	}
 	if len(f.Imports) == 0 {
 		return "", "", fmt.Errorf("unrecognized interface: %s", iface)
@@ -84,7 +72,7 @@ func findInterface(iface string, srcDir string) (path string, id string, err err
 	raw := f.Imports[0].Path.Value   // "io"
 	path, err = strconv.Unquote(raw) // io
 	if err != nil {
-		panic(err)
+		return "", "", fmt.Errorf("couldn't parse import of interface: %s", raw)
 	}
 	decl := f.Decls[1].(*ast.GenDecl)      // var i io.Reader
 	spec := decl.Specs[0].(*ast.ValueSpec) // i io.Reader
@@ -93,199 +81,658 @@ func findInterface(iface string, srcDir string) (path string, id string, err err
 	return path, id, nil
 }
 
-// Pkg is a parsed build.Package.
-type Pkg struct {
-	*build.Package
-	*token.FileSet
+// Method represents a method signature.
+// It is data of templates of stubs (see ImplOptions).
+type Method struct {
+	Recv string
+	Func
+
+	// RecvName - name of receiver variable (e.g. "f" of "f *File")
+	RecvName string
+	// Field - field of receiver whose method is called by delegating stub,
+	// "" if no field has the method
+	Field string
+	// Args - arguments of call with parameters of method (e.g. "ctx, items...")
+	Args string
+}
+
+// Func represents a function signature.
+type Func struct {
+	Name   string
+	Params []Param
+	Res    []Param
+}
+
+// Param represents a parameter in a function or method signature.
+type Param struct {
+	Name string
+	Type string
+
+	typ types.Type
+}
+
+// implPackage - type-checked package of destination file of stubs
+type implPackage struct {
+	fset     *token.FileSet
+	imp      types.ImporterFrom
+	pkg      *types.Package
+	file     *ast.File // destination file
+	files    []*ast.File
+	filename string
+
+	imported map[string]string // import path -> name in destination file
+	added    []Import          // imports needed by stubs
+	external bool              // destination file is in external test package
 }
 
-// typeSpec locates the *ast.TypeSpec for type id in the import path.
-func typeSpec(path string, id string, srcDir string) (Pkg, *ast.TypeSpec, error) {
-	pkg, err := build.Import(path, srcDir, 0)
+// loadImplPackage - package of filename type-checked from source
+// Errors of type checking are ignored, so incomplete package can be used.
+// Contents of other files of package are taken from srcs by absolute paths
+// if they are there (see ReadFile).
+func loadImplPackage(filename string, src []byte, srcs map[string][]byte) (*implPackage, error) {
+	filename, err := filepath.Abs(filename)
 	if err != nil {
-		return Pkg{}, nil, fmt.Errorf("couldn't find package %s: %v", path, err)
+		return nil, errors.Wrap(err, "error on get abs path")
+	}
+	src, err = ReadFile(filename, src)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read file")
 	}
 
-	fset := token.NewFileSet() // share one fset across the whole package
-	for _, file := range pkg.GoFiles {
-		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, file), nil, 0)
+	p := &implPackage{fset: token.NewFileSet(), filename: filename, imported: make(map[string]string)}
+	p.file, err = parser.ParseFile(p.fset, filename, src, 0)
+	if p.file == nil {
+		return nil, errors.Wrap(err, "error on parse file")
+	}
+	files := []*ast.File{p.file}
+
+	dir := filepath.Dir(filename)
+	names, err := goFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	bctx := NewBuildContext("", "", nil)
+	for _, name := range names {
+		other := filepath.Join(dir, name)
+		if other == filename || strings.HasSuffix(name, "_test.go") != strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		if ok, err := bctx.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+		otherSrc, err := ReadFile(other, srcs[other])
+		if err != nil {
+			return nil, errors.Wrap(err, "error on read file")
+		}
+		f, _ := parser.ParseFile(p.fset, other, otherSrc, 0)
+		if f != nil && f.Name.Name == p.file.Name.Name {
+			files = append(files, f)
+		}
+	}
+
+	importPath, err := dirImportPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if importPath == "" || p.file.Name.Name == "main" {
+		importPath = p.file.Name.Name
+	}
+	p.imp = importer.ForCompiler(p.fset, "source", nil).(types.ImporterFrom)
+	conf := types.Config{Importer: p.imp, Error: func(error) {}}
+	p.files = files
+	p.pkg, _ = conf.Check(importPath, p.fset, files, nil)
+	if p.pkg == nil {
+		return nil, errors.Errorf("package of %s can not be type-checked", filename)
+	}
+
+	// names of imports of destination file
+	byPath := make(map[string]*types.Package)
+	for _, ip := range p.pkg.Imports() {
+		byPath[ip.Path()] = ip
+	}
+	for _, spec := range p.file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
 		if err != nil {
 			continue
 		}
+		switch {
+		case spec.Name != nil:
+			p.imported[path] = spec.Name.Name
+		case byPath[path] != nil:
+			p.imported[path] = byPath[path].Name()
+		default:
+			p.imported[path] = assumedPackageName(path)
+		}
+	}
+	return p, nil
+}
 
-		for _, decl := range f.Decls {
-			decl, ok := decl.(*ast.GenDecl)
-			if !ok || decl.Tok != token.TYPE {
-				continue
-			}
-			for _, spec := range decl.Specs {
-				spec := spec.(*ast.TypeSpec)
-				if spec.Name.Name != id {
-					continue
-				}
-				return Pkg{Package: pkg, FileSet: fset}, spec, nil
-			}
+// dirImportPath - import path of package in dir, "" if dir is not in any root
+func dirImportPath(dir string) (string, error) {
+	roots, err := importRoots(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range roots {
+		if inTree(dir, r.Dir) {
+			return importPathOf(r, dir), nil
 		}
 	}
-	return Pkg{}, nil, fmt.Errorf("type %s not found in %s", id, path)
+	return "", nil
 }
 
-// gofmt pretty-prints e.
-func (p Pkg) gofmt(e ast.Expr) string {
-	var buf bytes.Buffer
-	printer.Fprint(&buf, p.FileSet, e)
-	return buf.String()
-}
-
-// fullType returns the fully qualified type of e.
-// Examples, assuming package net/http:
-// 	fullType(int) => "int"
-// 	fullType(Handler) => "http.Handler"
-// 	fullType(io.Reader) => "io.Reader"
-// 	fullType(*Request) => "*http.Request"
-func (p Pkg) fullType(e ast.Expr) string {
-	ast.Inspect(e, func(n ast.Node) bool {
-		switch n := n.(type) {
-		case *ast.Ident:
-			// Using typeSpec instead of IsExported here would be
-			// more accurate, but it'd be crazy expensive, and if
-			// the type isn't exported, there's no point trying
-			// to implement it anyway.
-			if n.IsExported() {
-				n.Name = p.Package.Name + "." + n.Name
-			}
-		case *ast.SelectorExpr:
-			return false
+// interfaceName - import path and name of interface named by iface: "error",
+// declared in package ("" path), imported by destination file ("io.Reader")
+// or by import path ("net/http.Handler")
+func (p *implPackage) interfaceName(iface string) (string, string, error) {
+	dot := strings.LastIndex(iface, ".")
+	if dot < 0 {
+		return "", iface, nil
+	}
+	path, name := iface[:dot], iface[dot+1:]
+	if strings.Contains(path, "/") {
+		return path, name, nil
+	}
+	for importPath, n := range p.imported {
+		if n == path {
+			return importPath, name, nil
 		}
-		return true
-	})
-	return p.gofmt(e)
+	}
+	return findInterface(iface, filepath.Dir(p.filename))
 }
 
-func (p Pkg) params(field *ast.Field) []Param {
-	var params []Param
-	typ := p.fullType(field.Type)
-	for _, name := range field.Names {
-		params = append(params, Param{Name: name.Name, Type: typ})
+const (
+	implCheckFile   = "__golime_impl__.go"
+	implCheckImport = "golimeiface"
+	implCheckMethod = "golimeImplCheck"
+)
+
+// resolve - type of receiver and interface iface instantiated with its type arguments
+// (e.g. "Store[string, *User]"). They are type-checked by method of recv, which is added
+// to package in file with imports of destination file, so arguments are qualified
+// as in destination file and type parameters of receiver (e.g. "c *Container[T]")
+// can be used as arguments. Type of receiver is nil if recv is empty.
+func (p *implPackage) resolve(recv, iface string) (types.Type, *types.Interface, error) {
+	base, args := iface, ""
+	if i := strings.IndexByte(iface, '['); i >= 0 {
+		base, args = iface[:i], iface[i:]
+	}
+	path, name, err := p.interfaceName(base)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	typ := name + args
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n\nimport (\n", p.file.Name.Name)
+	for _, spec := range p.file.Imports {
+		if spec.Name != nil {
+			b.WriteString(spec.Name.Name + " ")
+		}
+		b.WriteString(spec.Path.Value + "\n")
+	}
+	if path != "" && path != p.pkg.Path() {
+		fmt.Fprintf(&b, "%s %q\n", implCheckImport, path)
+		typ = implCheckImport + "." + typ
+	}
+	if recv != "" {
+		recv = "(" + recv + ") "
+	}
+	fmt.Fprintf(&b, ")\n\nfunc %s%s() {\n\tvar _ %s\n}\n", recv, implCheckMethod, typ)
+
+	filename := filepath.Join(filepath.Dir(p.filename), implCheckFile)
+	f, err := parser.ParseFile(p.fset, filename, b.String(), 0)
+	if err != nil {
+		return nil, nil, errors.Errorf("couldn't parse interface: %s", iface)
+	}
+	decl := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+	spec := decl.Body.List[0].(*ast.DeclStmt).Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+
+	// errors of other files and of unused imports are ignored
+	var checkErrs []types.Error
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue), Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Importer: p.imp, Error: func(err error) {
+		if te, ok := err.(types.Error); ok && te.Pos >= decl.Pos() && te.Pos < decl.End() {
+			checkErrs = append(checkErrs, te)
+		}
+	}}
+	pkg, _ := conf.Check(p.pkg.Path(), p.fset, append(p.files, f), info)
+	if pkg == nil {
+		return nil, nil, errors.Errorf("package of %s can not be type-checked", p.filename)
 	}
-	// Handle anonymous params
-	if len(params) == 0 {
-		params = []Param{Param{Type: typ}}
+	p.pkg = pkg
+
+	t := info.Types[spec.Type].Type
+	var it *types.Interface
+	if t != nil {
+		it, _ = t.Underlying().(*types.Interface)
 	}
-	return params
+	for _, te := range checkErrs {
+		// constraint can not be type of variable, it is checked by checkTypeSet
+		if te.Pos == spec.Type.Pos() && it != nil && !it.IsMethodSet() {
+			continue
+		}
+		return nil, nil, errors.Wrapf(errors.New(te.Msg), "error on check %s of %s", iface, recv)
+	}
+	if t == nil {
+		return nil, nil, errors.Errorf("interface %s is not found", iface)
+	}
+	if it == nil {
+		return nil, nil, errors.Errorf("not an interface: %s", iface)
+	}
+	fn, ok := info.Defs[decl.Name].(*types.Func)
+	if !ok {
+		return nil, nil, errors.Errorf("invalid receiver: %q", recv)
+	}
+	if fn.Type().(*types.Signature).Recv() == nil {
+		return nil, it, nil
+	}
+	return fn.Type().(*types.Signature).Recv().Type(), it, nil
 }
 
-// Method represents a method signature.
-type Method struct {
-	Recv string
-	Func
+// checkTypeSet - recv is in type set of constraint interface iface,
+// which embeds comparable or unions of types (e.g. "~int | ~string"),
+// so recv with stubs of methods can be its type argument
+func checkTypeSet(recv types.Type, iface *types.Interface) error {
+	if iface.IsMethodSet() {
+		return nil
+	}
+	if iface.IsComparable() && !types.Comparable(recv) {
+		return errors.Errorf("%s is not comparable", recv)
+	}
+	for _, u := range typeUnions(iface) {
+		if !types.Satisfies(recv, types.NewInterfaceType(nil, []types.Type{u}).Complete()) {
+			return errors.Errorf("%s is not in type set %s", recv, u)
+		}
+	}
+	return nil
 }
 
-// Func represents a function signature.
-type Func struct {
-	Name   string
-	Params []Param
-	Res    []Param
+// typeUnions - unions of types embedded into iface and into its embedded interfaces
+func typeUnions(iface *types.Interface) []*types.Union {
+	var out []*types.Union
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		switch t := iface.EmbeddedType(i).(type) {
+		case *types.Union:
+			out = append(out, t)
+		default:
+			if it, ok := t.Underlying().(*types.Interface); ok {
+				out = append(out, typeUnions(it)...)
+			}
+		}
+	}
+	return out
 }
 
-// Param represents a parameter in a function or method signature.
-type Param struct {
-	Name string
-	Type string
+// qualifier - name of package in destination file,
+// import of package is added if file does not import it
+func (p *implPackage) qualifier(other *types.Package) string {
+	if !p.external && (other == p.pkg || other.Path() == p.pkg.Path()) {
+		return ""
+	}
+	name, ok := p.imported[other.Path()]
+	if !ok {
+		name = p.importName(other.Name())
+		p.imported[other.Path()] = name
+		imp := Import{Path: other.Path()}
+		if name != other.Name() {
+			imp.Name = name
+		}
+		p.added = append(p.added, imp)
+	}
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+// importName - name of new import of package named name, which is not used
+// by other imports of destination file and by declarations of its package
+// ("template2" if file imports "text/template" and "html/template" is added)
+func (p *implPackage) importName(name string) string {
+	used := make(map[string]bool)
+	for _, n := range p.imported {
+		used[n] = true
+	}
+	free := func(n string) bool {
+		return !used[n] && (p.external || p.pkg.Scope().Lookup(n) == nil)
+	}
+	alias := name
+	for i := 2; !free(alias); i++ {
+		alias = name + strconv.Itoa(i)
+	}
+	return alias
 }
 
-func (p Pkg) funcsig(f *ast.Field) Func {
-	fn := Func{Name: f.Names[0].Name}
-	typ := f.Type.(*ast.FuncType)
-	if typ.Params != nil {
-		for _, field := range typ.Params.List {
-			fn.Params = append(fn.Params, p.params(field)...)
+// MethodConflict - method of interface which receiver already has with other signature
+type MethodConflict struct {
+	Name string `json:"name"`
+	Have string `json:"have"` // signature of method or type of field of receiver
+	Want string `json:"want"` // signature of method of interface
+}
+
+// missingMethods - methods of iface which recv does not have (promoted ones are counted
+// unless promoted is set), methods with the same names but other types and
+// fields with the same names are conflicts
+func (p *implPackage) missingMethods(recv types.Type, iface *types.Interface, promoted bool) ([]*types.Func, []MethodConflict, error) {
+	var missing []*types.Func
+	var conflicts []MethodConflict
+	rel := types.RelativeTo(p.pkg)
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		if !m.Exported() && m.Pkg() != nil && m.Pkg().Path() != p.pkg.Path() {
+			return nil, nil, errors.Errorf("unexported method %s of interface of other package can not be implemented", m.Name())
+		}
+		obj, index, _ := types.LookupFieldOrMethod(recv, true, p.pkg, m.Name())
+		// field is not a method even if it has type of the method
+		_, isField := obj.(*types.Var)
+		switch {
+		case obj == nil:
+			missing = append(missing, m)
+		case isField || !types.Identical(obj.Type(), m.Type()):
+			conflicts = append(conflicts, MethodConflict{
+				Name: m.Name(),
+				Have: types.TypeString(obj.Type(), rel),
+				Want: types.TypeString(m.Type(), rel),
+			})
+		case promoted && len(index) > 1:
+			missing = append(missing, m)
 		}
 	}
-	if typ.Results != nil {
-		for _, field := range typ.Results.List {
-			fn.Res = append(fn.Res, p.params(field)...)
+	return missing, conflicts, nil
+}
+
+// funcOf - signature of method with types qualified for destination file
+func (p *implPackage) funcOf(m *types.Func) Func {
+	sig := m.Type().(*types.Signature)
+	fn := Func{Name: m.Name()}
+	for i := 0; i < sig.Params().Len(); i++ {
+		v := sig.Params().At(i)
+		typ := types.TypeString(v.Type(), p.qualifier)
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			typ = "..." + types.TypeString(v.Type().(*types.Slice).Elem(), p.qualifier)
 		}
+		fn.Params = append(fn.Params, Param{Name: v.Name(), Type: typ, typ: v.Type()})
+	}
+	for i := 0; i < sig.Results().Len(); i++ {
+		v := sig.Results().At(i)
+		fn.Res = append(fn.Res, Param{Name: v.Name(), Type: types.TypeString(v.Type(), p.qualifier), typ: v.Type()})
 	}
 	return fn
 }
 
-// The error interface is built-in.
-var errorInterface = []Func{{
-	Name: "Error",
-	Res:  []Param{{Type: "string"}},
-}}
-
-// funcs returns the set of methods required to implement iface.
-// It is called funcs rather than methods because the
-// function descriptions are functions; there is no receiver.
-func funcs(iface string, srcDir string) ([]Func, error) {
-	// Special case for the built-in error interface.
-	if iface == "error" {
-		return errorInterface, nil
+// funcs returns the set of methods required to implement iface,
+// which recv does not have yet, and conflicting methods.
+// Types are qualified for destination file (see qualifier).
+// With StubDelegate methods promoted from field which stubs delegate to are stubbed too.
+func (p *implPackage) funcs(recv string, iface string, opt ImplOptions) ([]Method, []MethodConflict, error) {
+	recvType, it, err := p.resolve(recv, iface)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	// Locate the interface.
-	path, id, err := findInterface(iface, srcDir)
+	err = checkTypeSet(recvType, it)
 	if err != nil {
-		return nil, err
+		return nil, nil, errors.Wrapf(err, "%s can not implement %s", recv, iface)
 	}
 
-	// Parse the package and find the interface declaration.
-	p, spec, err := typeSpec(path, id, srcDir)
+	delegate := opt.Body == StubDelegate && opt.Template == ""
+	missing, conflicts, err := p.missingMethods(recvType, it, delegate)
 	if err != nil {
-		return nil, fmt.Errorf("interface %s not found: %s", iface, err)
+		return nil, nil, err
 	}
-	idecl, ok := spec.Type.(*ast.InterfaceType)
-	if !ok {
-		return nil, fmt.Errorf("not an interface: %s", iface)
+	recvName, _ := receiverNames(recv)
+	var ms []Method
+	for _, m := range missing {
+		meth := Method{Recv: recv, Func: p.funcOf(m), RecvName: recvName}
+		if delegate {
+			meth.Field = delegateField(recvType, p.pkg, opt.Field, m)
+			if obj, _, _ := types.LookupFieldOrMethod(recvType, true, p.pkg, m.Name()); meth.Field == "" && obj != nil {
+				// promoted from other field
+				continue
+			}
+		}
+		ms = append(ms, meth)
+	}
+
+	// imports are known after types of all methods are qualified
+	reserved := []string{recvName}
+	if opt.Body == StubZero || opt.Template != "" {
+		reserved = append(reserved, "errors")
 	}
+	p.nameMethods(ms, reserved, delegate || opt.Template != "", opt.Body == StubZero || opt.Template != "")
+	return ms, conflicts, nil
+}
 
-	if idecl.Methods == nil {
-		return nil, fmt.Errorf("empty interface: %s", iface)
+// nameMethods - name variables of methods (see nameVars), so they do not shadow
+// reserved names and imports of destination file, and set arguments of their calls
+func (p *implPackage) nameMethods(ms []Method, reserved []string, params, results bool) {
+	for i := range ms {
+		used := make(map[string]bool)
+		for _, name := range reserved {
+			used[name] = true
+		}
+		for _, name := range p.imported {
+			used[name] = true
+		}
+		nameVars(ms[i].Params, used, params)
+		nameVars(ms[i].Res, used, results)
+		ms[i].Args = callArgs(ms[i].Params)
 	}
+}
 
-	var fns []Func
-	for _, fndecl := range idecl.Methods.List {
-		if len(fndecl.Names) == 0 {
-			// Embedded interface: recurse
-			embedded, err := funcs(p.fullType(fndecl.Type), srcDir)
-			if err != nil {
-				return nil, err
-			}
-			fns = append(fns, embedded...)
+// callArgs - arguments of call with parameters (e.g. "ctx, items...")
+func callArgs(params []Param) string {
+	var args []string
+	for _, v := range params {
+		args = append(args, v.Name)
+	}
+	out := strings.Join(args, ", ")
+	if n := len(params); n > 0 && strings.HasPrefix(params[n-1].Type, "...") {
+		out += "..."
+	}
+	return out
+}
+
+// delegateField - field of struct recv named name (embedded one if name is empty)
+// which has method m, "" if there is no such field
+func delegateField(recv types.Type, pkg *types.Package, name string, m *types.Func) string {
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+	}
+	st, ok := recv.Underlying().(*types.Struct)
+	if !ok {
+		return ""
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if name != "" && f.Name() != name || name == "" && !f.Embedded() {
 			continue
 		}
+		obj, _, _ := types.LookupFieldOrMethod(f.Type(), true, pkg, m.Name())
+		if fn, ok := obj.(*types.Func); ok && types.Identical(fn.Type(), m.Type()) {
+			return f.Name()
+		}
+	}
+	return ""
+}
 
-		fn := p.funcsig(fndecl)
-		fns = append(fns, fn)
+// nameVars - rename variables whose names are used (by receiver, imports or other
+// variables of method), unnamed and blank ones are named by their types if all is set.
+// Names of variables are added to used.
+func nameVars(vars []Param, used map[string]bool, all bool) {
+	for i := range vars {
+		v := &vars[i]
+		generated := false
+		if v.Name == "" || v.Name == "_" {
+			if !all {
+				continue
+			}
+			v.Name, generated = varName(v.typ), true
+		}
+		name := v.Name
+		for n := 1; used[name] || token.IsKeyword(name) || generated && types.Universe.Lookup(name) != nil; n++ {
+			name = v.Name + strconv.Itoa(n)
+		}
+		v.Name = name
+		used[name] = true
 	}
-	return fns, nil
 }
 
-const stub = "func ({{.Recv}}) {{.Name}}" +
+// varName - name of variable of type t (e.g. "err", "ctx", "item" of *Item or "items" of []Item)
+func varName(t types.Type) string {
+	switch t := t.(type) {
+	case *types.Named:
+		switch {
+		case t.Obj().Name() == "error" && t.Obj().Pkg() == nil:
+			return "err"
+		case t.Obj().Name() == "Context":
+			return "ctx"
+		}
+		return lowerFirst(t.Obj().Name())
+	case *types.TypeParam:
+		return lowerFirst(t.Obj().Name())
+	case *types.Pointer:
+		return varName(t.Elem())
+	case *types.Slice:
+		if b, ok := t.Elem().(*types.Basic); ok && b.Kind() == types.Byte {
+			return "data"
+		}
+		if name := varName(t.Elem()); len(name) > 2 {
+			return name + "s"
+		}
+		return "list"
+	case *types.Array:
+		return varName(types.NewSlice(t.Elem()))
+	case *types.Map:
+		return "m"
+	case *types.Chan:
+		return "ch"
+	case *types.Signature:
+		return "fn"
+	case *types.Basic:
+		switch {
+		case t.Info()&types.IsBoolean != 0:
+			return "ok"
+		case t.Info()&types.IsString != 0:
+			return "s"
+		case t.Info()&types.IsNumeric != 0:
+			return "n"
+		}
+	}
+	return "v"
+}
+
+// lowerFirst - name with lower case initialism or first letter (e.g. "url" of "URL", "httpClient" of "HTTPClient")
+func lowerFirst(name string) string {
+	rs := []rune(name)
+	for i := range rs {
+		if !unicode.IsUpper(rs[i]) {
+			break
+		}
+		if i > 0 && i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+			break
+		}
+		rs[i] = unicode.ToLower(rs[i])
+	}
+	return string(rs)
+}
+
+// errorsPackage - name of package with New(string) error in destination file,
+// import of "errors" is added if file imports neither it nor github.com/pkg/errors
+func (p *implPackage) errorsPackage() string {
+	if name, ok := p.imported["github.com/pkg/errors"]; ok {
+		return name
+	}
+	return p.qualifier(types.NewPackage("errors", "errors"))
+}
+
+// Stub body styles (see ImplOptions)
+const (
+	// StubPanic - panic("not implemented")
+	StubPanic = "panic"
+	// StubZero - return zero values of named results, errors.New("not implemented") for errors
+	StubZero = "zero"
+	// StubDelegate - call of method of field of receiver, panic if no field has it
+	StubDelegate = "delegate"
+)
+
+// ImplOptions - options of ImplWith
+type ImplOptions struct {
+	// Body - style of bodies of stubs, StubPanic by default
+	Body string
+	// Field - field of receiver which StubDelegate calls methods of,
+	// embedded field which has method by default
+	Field string
+	// Template - file of text/template of stub executed with Method, it overrides Body.
+	// Parameters and results are named, function errors returns name of package
+	// with New(string) error (e.g. {{errors}}.New("not implemented")).
+	Template string
+}
+
+const stubSignature = "func ({{.Recv}}) {{.Name}}" +
 	"({{range .Params}}{{.Name}} {{.Type}}, {{end}})" +
-	"({{range .Res}}{{.Name}} {{.Type}}, {{end}})" +
+	"({{range .Res}}{{.Name}} {{.Type}}, {{end}})"
+
+const stub = stubSignature +
 	"{\n" + "panic(\"not implemented\")" + "}\n\n"
 
-var tmpl = template.Must(template.New("test").Parse(stub))
+const zeroStub = stubSignature + "{\n" +
+	`{{range .Res}}{{if eq .Type "error"}}{{.Name}} = {{errors}}.New("not implemented")` + "\n{{end}}{{end}}" +
+	"{{if .Res}}return\n{{end}}" +
+	"}\n\n"
+
+const delegateStub = stubSignature + "{\n" +
+	"{{if .Field}}{{if .Res}}return {{end}}{{.RecvName}}.{{.Field}}.{{.Name}}({{.Args}})" +
+	"{{else}}panic(\"not implemented\"){{end}}" +
+	"}\n\n"
+
+// stubTemplates - templates of stubs by style of body
+var stubTemplates = map[string]string{
+	StubPanic:    stub,
+	StubZero:     zeroStub,
+	StubDelegate: delegateStub,
+}
+
+// stubTemplate - template of stubs of options
+func (p *implPackage) stubTemplate(opt ImplOptions) (*template.Template, error) {
+	text, ok := stubTemplates[opt.Body]
+	switch {
+	case opt.Template != "":
+		bs, err := ReadFile(opt.Template, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on read template")
+		}
+		text = string(bs)
+	case opt.Body == "":
+		text = stub
+	case !ok:
+		return nil, errors.Errorf("unknown style of stub body: %q", opt.Body)
+	}
+	t, err := template.New("stub").Funcs(template.FuncMap{"errors": p.errorsPackage}).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on parse template of stub")
+	}
+	return t, nil
+}
 
 // genStubs prints nicely formatted method stubs
-// for fns using receiver expression recv.
-// If recv is not a valid receiver expression,
-// genStubs will panic.
-func genStubs(recv string, fns []Func) []byte {
+// for methods ms using template t.
+func genStubs(t *template.Template, ms []Method) ([]byte, error) {
 	var buf bytes.Buffer
-	for _, fn := range fns {
-		meth := Method{Recv: recv, Func: fn}
-		tmpl.Execute(&buf, meth)
+	for _, meth := range ms {
+		err := t.Execute(&buf, meth)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on execute template of stub")
+		}
+		// blank lines are collapsed by format
+		buf.WriteString("\n\n")
 	}
 
 	pretty, err := format.Source(buf.Bytes())
 	if err != nil {
-		panic(err)
+		return nil, errors.Wrap(err, "error on format stubs")
 	}
-	return pretty
+	return pretty, nil
 }
 
 // validReceiver reports whether recv is a valid receiver expression.
@@ -300,35 +747,155 @@ func validReceiver(recv string) bool {
 	return err == nil
 }
 
-// func main() {
-// 	flag.Parse()
+// ImplResult - edits which add stubs and imports needed by them,
+// methods which receiver has with other signatures are not stubbed
+type ImplResult struct {
+	Edits     []TextEdit
+	Conflicts []MethodConflict
+}
 
-// 	if len(flag.Args()) < 2 {
-// 		fmt.Fprint(os.Stderr, usage)
-// 		os.Exit(2)
-// 	}
+// Impl - stubs of methods of iface which receiver recv does not have yet,
+// they are inserted right after declaration of type of receiver in package of filename
+// (e.g. recv "f *File" and iface "io.Reader", "net/http.Handler" or "Store" of package).
+// Generic interface is instantiated by its type arguments (e.g. "Store[string, *User]"),
+// which may be type parameters of receiver (e.g. recv "c *Container[T]").
+// Receiver has to be in type set of interface which embeds comparable or unions of types.
+// Types are checked from source, so stubs are qualified by imports of file
+// where they are inserted and missing imports are added.
+// If src != nil, it is used as content of file (see ReadFile).
+func Impl(filename string, src []byte, recv, iface string) (*ImplResult, error) {
+	return ImplWith(filename, src, recv, iface, ImplOptions{})
+}
 
-// 	recv, iface := flag.Arg(0), flag.Arg(1)
-// 	if !validReceiver(recv) {
-// 		fatal(fmt.Sprintf("invalid receiver: %q", recv))
-// 	}
+// ImplWith - Impl with options of bodies of stubs
+func ImplWith(filename string, src []byte, recv, iface string, opt ImplOptions) (*ImplResult, error) {
+	if !validReceiver(recv) {
+		return nil, errors.Errorf("invalid receiver: %q", recv)
+	}
+	recvName, typeName := receiverNames(recv)
+	if opt.Body == StubDelegate && recvName == "" {
+		return nil, errors.Errorf("receiver %q has no name to delegate", recv)
+	}
 
-// 	if *flagSrcDir == "" {
-// 		if dir, err := os.Getwd(); err == nil {
-// 			*flagSrcDir = dir
-// 		}
-// 	}
+	// src of filename is used even if type is declared in other file
+	var srcs map[string][]byte
+	if src != nil {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on get abs path")
+		}
+		srcs = map[string][]byte{abs: src}
+	}
+	declFile, offset, err := typeDeclEnd(filename, src, typeName)
+	if err != nil {
+		return nil, err
+	}
+	if declFile != filename {
+		src = nil
+	}
+	src, err = ReadFile(declFile, src)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read file")
+	}
 
-// 	fns, err := funcs(iface, *flagSrcDir)
-// 	if err != nil {
-// 		fatal(err)
-// 	}
+	p, err := loadImplPackage(declFile, src, srcs)
+	if err != nil {
+		return nil, err
+	}
+	t, err := p.stubTemplate(opt)
+	if err != nil {
+		return nil, err
+	}
+	ms, conflicts, err := p.funcs(recv, iface, opt)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on find methods of interface")
+	}
 
-// 	src := genStubs(recv, fns)
-// 	fmt.Print(string(src))
-// }
+	res := &ImplResult{Edits: []TextEdit{}, Conflicts: conflicts}
+	if res.Conflicts == nil {
+		res.Conflicts = []MethodConflict{}
+	}
+	if len(ms) == 0 {
+		return res, nil
+	}
+	stubs, err := genStubs(t, ms)
+	if err != nil {
+		return nil, err
+	}
+	res.Edits = append(res.Edits, TextEdit{
+		File:    declFile,
+		Start:   offset,
+		End:     offset,
+		NewText: "\n\n" + strings.TrimRight(string(stubs), "\n"),
+	})
+
+	if len(p.added) > 0 {
+		edits, err := AddImports(declFile, p.added, src)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on add imports")
+		}
+		res.Edits = append(res.Edits, edits...)
+	}
+	SortEdits(res.Edits)
+	return res, nil
+}
 
-// func fatal(msg interface{}) {
-// 	fmt.Fprintln(os.Stderr, msg)
-// 	os.Exit(1)
-// }
+// receiverNames - name of variable and name of type of valid receiver expression
+// (e.g. "f" and "File" of "f *File", "" and "Container" of "*Container[T]")
+func receiverNames(recv string) (string, string) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package hack\nfunc ("+recv+") Foo()", 0)
+	if err != nil {
+		return "", ""
+	}
+	field := f.Decls[0].(*ast.FuncDecl).Recv.List[0]
+	var name string
+	if len(field.Names) > 0 && field.Names[0].Name != "_" {
+		name = field.Names[0].Name
+	}
+	return name, receiverName(field.Type)
+}
+
+// typeDeclEnd - file of package of filename where type name is declared
+// and offset of end of its declaration, filename is checked first
+func typeDeclEnd(filename string, src []byte, name string) (string, int, error) {
+	dir := filepath.Dir(filename)
+	files, err := goFiles(dir)
+	if err != nil {
+		return "", 0, err
+	}
+	filenames := []string{filename}
+	for _, f := range files {
+		other := filepath.Join(dir, f)
+		if other != filepath.Clean(filename) && strings.HasSuffix(f, "_test.go") == strings.HasSuffix(filename, "_test.go") {
+			filenames = append(filenames, other)
+		}
+	}
+
+	for i, fn := range filenames {
+		var fileSrc []byte
+		if i == 0 {
+			fileSrc = src
+		}
+		fileSrc, err := ReadFile(fn, fileSrc)
+		if err != nil {
+			return "", 0, errors.Wrap(err, "error on read file")
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, fn, fileSrc, 0)
+		if file == nil {
+			return "", 0, errors.Wrap(err, "error on parse file")
+		}
+		for _, d := range file.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				if spec.(*ast.TypeSpec).Name.Name == name {
+					return fn, fset.Position(gd.End()).Offset, nil
+				}
+			}
+		}
+	}
+	return "", 0, errors.Errorf("type %s is not declared in package", name)
+}
@@ -0,0 +1,307 @@
+package tools
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImpl(t *testing.T) {
+	filename := "./testdata/impl/file.go"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+
+	// Write is promoted from io.Writer, Close has other signature
+	res, err := Impl(filename, nil, "f *File", "Store")
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	result, err := ApplyEdits(src, res.Edits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	expect := `package impl
+
+import (
+	"bytes"
+	stdctx "context"
+	"io"
+)
+
+// File - file with stubs
+type File struct {
+	name string
+	io.Writer
+}
+
+func (f *File) Flush(*bytes.Buffer) error {
+	panic("not implemented")
+}
+
+func (f *File) Get(ctx stdctx.Context, key string) (*Item, error) {
+	panic("not implemented")
+}
+
+func (f *File) Read(p []byte) (n int, err error) {
+	panic("not implemented")
+}
+
+func (f *File) Set(items ...Item) error {
+	panic("not implemented")
+}
+
+// Close - it conflicts with io.Closer
+func (f *File) Close() {}
+
+func other(ctx stdctx.Context) {}
+`
+	if string(result) != expect {
+		t.Errorf("Result: %s", result)
+		t.Errorf("Expect: %s", expect)
+	}
+	conflicts := []MethodConflict{{Name: "Close", Have: "func()", Want: "func() error"}}
+	if !reflect.DeepEqual(res.Conflicts, conflicts) {
+		t.Errorf("Wrong conflicts: %v", res.Conflicts)
+	}
+
+	// all methods of io.Writer are promoted
+	res, err = Impl(filename, nil, "f File", "io.Writer")
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	if len(res.Edits) != 0 || len(res.Conflicts) != 0 {
+		t.Errorf("Unexpected result of implemented interface: %v", res)
+	}
+
+	_, err = Impl(filename, nil, "u *Unknown", "io.Closer")
+	if err == nil {
+		t.Errorf("Expected error on unknown type of receiver")
+	}
+
+	// name of imported package is taken, other package is imported with alias
+	aliased := strings.Replace(string(src), "\t\"io\"\n", "\tbytes \"strings\"\n\t\"io\"\n", 1) + "\nvar _ = bytes.ToUpper\n"
+	res, err = Impl(filename, []byte(aliased), "f *File", "Store")
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	result, err = ApplyEdits([]byte(aliased), res.Edits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	for _, s := range []string{"\tbytes2 \"bytes\"\n", "Flush(*bytes2.Buffer) error {"} {
+		if !strings.Contains(string(result), s) {
+			t.Errorf("Result does not contain %q: %s", s, result)
+		}
+	}
+
+	// field with type of method conflicts with it
+	withField := strings.Replace(string(src), "\tname string\n", "\tname string\n\tSet  func(items ...Item) error\n", 1)
+	res, err = Impl(filename, []byte(withField), "f *File", "Store")
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	conflicts = []MethodConflict{
+		{Name: "Close", Have: "func()", Want: "func() error"},
+		{Name: "Set", Have: "func(items ...Item) error", Want: "func(items ...Item) error"},
+	}
+	if !reflect.DeepEqual(res.Conflicts, conflicts) {
+		t.Errorf("Wrong conflicts with field: %v", res.Conflicts)
+	}
+
+	// unsaved content of other file than file of type is used too
+	other := "./testdata/impl/store.go"
+	otherSrc, err := ioutil.ReadFile(other)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+	otherSrc = append(otherSrc, "\nfunc (f *File) Flush(*bytes.Buffer) error { return nil }\n"...)
+	res, err = Impl(other, otherSrc, "f *File", "Store")
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	if len(res.Edits) == 0 || res.Edits[0].File != filepath.Join("testdata", "impl", "file.go") {
+		t.Fatalf("Wrong edits: %v", res.Edits)
+	}
+	for _, e := range res.Edits {
+		if strings.Contains(e.NewText, "Flush") {
+			t.Errorf("Method of unsaved file is stubbed: %s", e.NewText)
+		}
+	}
+}
+
+func TestImplGeneric(t *testing.T) {
+	filename := "./testdata/impl/generic.go"
+
+	// type arguments are substituted, including type parameters of receiver
+	res, err := Impl(filename, nil, "c *Container[T]", "Cache[string, []T]")
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	if len(res.Edits) != 1 {
+		t.Fatalf("Wrong edits: %v", res.Edits)
+	}
+	expect := `
+
+func (c *Container[T]) Get(key string) ([]T, bool) {
+	panic("not implemented")
+}
+
+func (c *Container[T]) Keys() []string {
+	panic("not implemented")
+}
+
+func (c *Container[T]) Put(key string, value []T) {
+	panic("not implemented")
+}`
+	if res.Edits[0].NewText != expect {
+		t.Errorf("Result: %s", res.Edits[0].NewText)
+		t.Errorf("Expect: %s", expect)
+	}
+
+	// type set of constraint is checked, its methods are stubbed
+	for _, c := range []struct {
+		recv, iface string
+		ok          bool
+	}{
+		{"c Count", "Number", true},
+		{"c *Count", "Number", false},
+		{"u Users", "Keyed", true},
+		{"c Container[T]", "Keyed", false},
+		{"u *Users", "Cache[int, *Users]", true},
+		{"u *Users", "Cache", false},
+	} {
+		res, err := Impl(filename, nil, c.recv, c.iface)
+		if (err == nil) != c.ok {
+			t.Errorf("Unexpected error of %s on %s: %v", c.iface, c.recv, err)
+			continue
+		}
+		if c.ok && len(res.Edits) != 1 {
+			t.Errorf("Wrong edits of %s on %s: %v", c.iface, c.recv, res.Edits)
+		}
+	}
+}
+
+func TestImplBody(t *testing.T) {
+	filename := "./testdata/impl/file.go"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+
+	// results are named, parameter p is renamed as it shadows receiver
+	res, err := ImplWith(filename, nil, "p *File", "io.ReadCloser", ImplOptions{Body: StubZero})
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	result, err := ApplyEdits(src, res.Edits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	expect := `package impl
+
+import (
+	stdctx "context"
+	"errors"
+	"io"
+)
+
+// File - file with stubs
+type File struct {
+	name string
+	io.Writer
+}
+
+func (p *File) Read(p1 []byte) (n int, err error) {
+	err = errors.New("not implemented")
+	return
+}
+
+// Close - it conflicts with io.Closer
+func (f *File) Close() {}
+
+func other(ctx stdctx.Context) {}
+`
+	if string(result) != expect {
+		t.Errorf("Result: %s", result)
+		t.Errorf("Expect: %s", expect)
+	}
+
+	// methods promoted from embedded Store are stubbed too, bytes and context are imported
+	res, err = ImplWith("./testdata/impl/logged.go", nil, "l *Logged", "Store", ImplOptions{Body: StubDelegate})
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	if len(res.Edits) != 2 {
+		t.Fatalf("Wrong edits: %v", res.Edits)
+	}
+	expect = `
+
+func (l *Logged) Close() error {
+	return l.Store.Close()
+}
+
+func (l *Logged) Flush(buffer *bytes.Buffer) error {
+	return l.Store.Flush(buffer)
+}
+
+func (l *Logged) Get(ctx context.Context, key string) (*Item, error) {
+	return l.Store.Get(ctx, key)
+}
+
+func (l *Logged) Read(p []byte) (n int, err error) {
+	return l.Store.Read(p)
+}
+
+func (l *Logged) Set(items ...Item) error {
+	return l.Store.Set(items...)
+}
+
+func (l *Logged) Write(p []byte) (n int, err error) {
+	return l.Store.Write(p)
+}`
+	if res.Edits[0].NewText != expect {
+		t.Errorf("Result: %s", res.Edits[0].NewText)
+		t.Errorf("Expect: %s", expect)
+	}
+
+	// Get of Cache conflicts with Get of Store
+	res, err = ImplWith("./testdata/impl/logged.go", nil, "l *Logged", "Cache[string, []byte]", ImplOptions{Template: "./testdata/impl/stub.tmpl"})
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	expect = `
+
+func (l *Logged) Keys() (list []string) {
+	l.logs = append(l.logs, "Keys")
+	return
+}
+
+func (l *Logged) Put(key string, value []byte) {
+	l.logs = append(l.logs, "Put")
+	return
+}`
+	if len(res.Edits) != 1 || res.Edits[0].NewText != expect {
+		t.Errorf("Result: %v", res.Edits)
+		t.Errorf("Expect: %s", expect)
+	}
+
+	res, err = ImplWith("./testdata/impl/logged.go", nil, "l *Logged", "io.Seeker", ImplOptions{Template: "./testdata/impl/stub.tmpl"})
+	if err != nil {
+		t.Fatalf("Error on impl: %v", err)
+	}
+	expect = `
+
+func (l *Logged) Seek(offset int64, whence int) (n int64, err error) {
+	l.logs = append(l.logs, "Seek")
+	err = errors.New("Seek is not implemented")
+	return
+}`
+	if len(res.Edits) != 2 || res.Edits[0].NewText != expect || res.Edits[1].NewText != "\n\nimport \"errors\"" {
+		t.Errorf("Result: %v", res.Edits)
+		t.Errorf("Expect: %s", expect)
+	}
+}
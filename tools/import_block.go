@@ -0,0 +1,300 @@
+package tools
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// importLine - import spec with its comments
+type importLine struct {
+	Name    string // explicit name, "" if it is not set
+	Path    string
+	Value   string // quoted path as it is written in source
+	Package string // name of imported package, "" if it is unknown (see resolveNames)
+
+	Doc     []string // comments above spec
+	Comment string   // comment at the end of line of spec
+}
+
+// name - name of imported package in file: explicit, real one
+// or assumed from path if package is unknown
+func (l importLine) name() string {
+	switch {
+	case l.Name != "":
+		return l.Name
+	case l.Package != "":
+		return l.Package
+	}
+	return assumedPackageName(l.Path)
+}
+
+// resolveNames - fill names of packages of lines without explicit name,
+// packages are looked up for file in dir (see packageNames)
+func resolveNames(lines []importLine, dir string) error {
+	var paths []string
+	for _, l := range lines {
+		if l.Name == "" {
+			paths = append(paths, l.Path)
+		}
+	}
+	names, err := packageNames(dir, paths)
+	if err != nil {
+		return errors.Wrap(err, "error on find names of packages")
+	}
+	for i := range lines {
+		if lines[i].Name == "" {
+			lines[i].Package = names[lines[i].Path]
+		}
+	}
+	return nil
+}
+
+// importBlock - import declarations of file which are rewritten by one edit
+//
+// Declarations `import "C"` with cgo preamble are never merged with others:
+// they are kept as is (the ones inside of rewritten range are copied verbatim).
+type importBlock struct {
+	Start, End int // byte offsets of rewritten range
+
+	Lines    []importLine
+	Trailing []string // comments after the last spec
+	Cgo      bool     // file imports "C"
+
+	hasDecls bool   // range contains declarations, otherwise it is empty
+	prevEnd  int    // end of package name or of cgo declaration before range
+	cgoText  string // verbatim cgo declarations inside of range
+}
+
+// parseImportBlock - import block of file parsed with comments
+func parseImportBlock(fset *token.FileSet, file *ast.File, src []byte) *importBlock {
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+
+	var b importBlock
+	var decls, cgo []*ast.GenDecl
+	for _, d := range getImportDecls(file) {
+		if isCgoDecl(d) {
+			cgo = append(cgo, d)
+			b.Cgo = true
+			continue
+		}
+		decls = append(decls, d)
+	}
+
+	b.prevEnd = offset(file.Name.End())
+	if len(decls) == 0 {
+		if len(cgo) > 0 {
+			b.prevEnd = offset(cgo[len(cgo)-1].End())
+		}
+		b.Start, b.End = b.prevEnd, b.prevEnd
+		return &b
+	}
+	b.hasDecls = true
+	b.Start, b.End = importsRange(fset, file, decls)
+
+	// comments of specs, others are attached to the next spec
+	used := make(map[*ast.CommentGroup]bool)
+	var specs []*ast.ImportSpec
+	for _, d := range decls {
+		for _, s := range d.Specs {
+			is := s.(*ast.ImportSpec)
+			used[is.Doc], used[is.Comment] = true, true
+			specs = append(specs, is)
+		}
+	}
+	for _, d := range cgo {
+		start, end := offset(d.Pos()), offset(d.End())
+		if d.Doc != nil {
+			start = offset(d.Doc.Pos())
+			used[d.Doc] = true
+		}
+		switch {
+		case end <= b.Start:
+			b.prevEnd = end
+		case start < b.End:
+			if b.cgoText != "" {
+				b.cgoText += "\n\n"
+			}
+			b.cgoText += string(src[start:end])
+		}
+	}
+
+	// free comment is attached to the next spec of its declaration,
+	// comment between declarations - to the next spec of block
+	extra := make(map[*ast.ImportSpec][]string)
+	for _, cg := range file.Comments {
+		pos := offset(cg.Pos())
+		if used[cg] || pos < b.Start || pos >= b.End {
+			continue
+		}
+		next := nextSpec(specs, cg.Pos())
+		for _, d := range decls {
+			if d.Pos() <= cg.Pos() && cg.Pos() < d.End() {
+				if next != nil && next.Pos() > d.End() {
+					next = nil
+				}
+				break
+			}
+		}
+		if next == nil {
+			b.Trailing = append(b.Trailing, commentLines(cg)...)
+			continue
+		}
+		extra[next] = append(extra[next], commentLines(cg)...)
+	}
+
+	for _, is := range specs {
+		p, err := strconv.Unquote(is.Path.Value)
+		if err != nil {
+			continue
+		}
+		l := importLine{Path: p, Value: is.Path.Value}
+		if is.Name != nil {
+			l.Name = is.Name.Name
+		}
+		l.Doc = append(extra[is], commentLines(is.Doc)...)
+		if is.Comment != nil {
+			l.Comment = strings.Join(commentLines(is.Comment), " ")
+		}
+		b.Lines = append(b.Lines, l)
+	}
+	return &b
+}
+
+// nextSpec - the first spec after pos, specs are sorted by position
+func nextSpec(specs []*ast.ImportSpec, pos token.Pos) *ast.ImportSpec {
+	i := sort.Search(len(specs), func(i int) bool { return specs[i].Pos() > pos })
+	if i == len(specs) {
+		return nil
+	}
+	return specs[i]
+}
+
+// isCgoDecl - declaration is `import "C"`
+func isCgoDecl(d *ast.GenDecl) bool {
+	if len(d.Specs) != 1 {
+		return false
+	}
+	is, ok := d.Specs[0].(*ast.ImportSpec)
+	return ok && is.Path.Value == `"C"`
+}
+
+func commentLines(cg *ast.CommentGroup) []string {
+	if cg == nil {
+		return nil
+	}
+	var out []string
+	for _, c := range cg.List {
+		out = append(out, c.Text)
+	}
+	return out
+}
+
+// add - append import to lines of block, pkgName is name of package if it is known
+func (b *importBlock) add(name, importPath, pkgName string) {
+	b.Lines = append(b.Lines, importLine{Name: name, Path: importPath, Value: strconv.Quote(importPath), Package: pkgName})
+}
+
+// edit - edit which replaces range of block with its lines grouped by format
+func (b *importBlock) edit(filename string, src []byte, localPrefix string) TextEdit {
+	res := TextEdit{File: filename, Start: b.Start, End: b.End}
+
+	text := formatImports(b.Lines, b.Trailing, localPrefix)
+	switch {
+	case b.cgoText != "" && text != "":
+		res.NewText = b.cgoText + "\n\n" + text
+	case b.cgoText != "":
+		res.NewText = b.cgoText
+	case !b.hasDecls && text != "":
+		// right after package name or cgo declaration
+		res.NewText = "\n\n" + text
+	case b.hasDecls && text == "":
+		// remove empty lines before removed imports too
+		if strings.TrimSpace(string(src[b.prevEnd:b.Start])) == "" {
+			res.Start = b.prevEnd
+		}
+	default:
+		res.NewText = text
+	}
+	return res
+}
+
+// Groups of imports
+const (
+	groupStdlib = iota
+	groupThirdParty
+	groupLocal
+)
+
+// importGroup - group of import path, stdlib paths have no dot in the first element
+func importGroup(importPath, localPrefix string) int {
+	for _, prefix := range strings.Split(localPrefix, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix != "" && (importPath == prefix || strings.HasPrefix(importPath, strings.TrimSuffix(prefix, "/")+"/")) {
+			return groupLocal
+		}
+	}
+	if !strings.Contains(strings.Split(importPath, "/")[0], ".") {
+		return groupStdlib
+	}
+	return groupThirdParty
+}
+
+// formatImports - import declaration with groups of imports separated by empty line
+func formatImports(lines []importLine, trailing []string, localPrefix string) string {
+	type spec struct {
+		importLine
+		line  string
+		group int
+	}
+	var specs []spec
+	seen := make(map[string]bool)
+	for _, l := range lines {
+		line := l.Value
+		if l.Name != "" {
+			line = l.Name + " " + line
+		}
+		if seen[line] {
+			continue
+		}
+		seen[line] = true
+		if l.Comment != "" {
+			line += " " + l.Comment
+		}
+		specs = append(specs, spec{importLine: l, line: line, group: importGroup(l.Path, localPrefix)})
+	}
+	sort.SliceStable(specs, func(i, j int) bool {
+		if specs[i].group != specs[j].group {
+			return specs[i].group < specs[j].group
+		}
+		return specs[i].Path < specs[j].Path
+	})
+
+	switch {
+	case len(specs) == 0:
+		return ""
+	case len(specs) == 1 && len(specs[0].Doc) == 0 && len(trailing) == 0:
+		return "import " + specs[0].line
+	}
+
+	var b strings.Builder
+	b.WriteString("import (\n")
+	for i, s := range specs {
+		if i > 0 && s.group != specs[i-1].group {
+			b.WriteString("\n")
+		}
+		for _, c := range s.Doc {
+			b.WriteString("\t" + c + "\n")
+		}
+		b.WriteString("\t" + s.line + "\n")
+	}
+	for _, c := range trailing {
+		b.WriteString("\t" + c + "\n")
+	}
+	b.WriteString(")")
+	return b.String()
+}
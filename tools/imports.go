@@ -1,32 +1,285 @@
 package tools
 
 import (
-	"fmt"
+	"context"
 	"go/build"
 	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
-func GetAllImportPaths() ([]string, error) {
+// Package - package found in roots of import paths
+type Package struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Dir      string `json:"dir"`
+	Main     bool   `json:"main,omitempty"`     // package main can not be imported
+	Internal bool   `json:"internal,omitempty"` // path has "internal" element
+	Vendor   bool   `json:"vendor,omitempty"`   // package is vendored, path is canonical one
+}
+
+// VisibleFrom - package can be imported by package in absolute dir:
+// internal package - only inside of tree of parent of "internal" directory,
+// vendored package - only inside of tree of parent of "vendor" directory.
+// Package main is never visible, others are visible from empty dir.
+func (p Package) VisibleFrom(dir string) bool {
+	switch {
+	case p.Main:
+		return false
+	case dir == "":
+		return true
+	case p.Vendor && !inTree(dir, parentOf(p.Dir, "vendor")):
+		return false
+	case p.Internal && !inTree(dir, parentOf(p.Dir, "internal")):
+		return false
+	}
+	return true
+}
+
+// parentOf - parent of the last element elem of dir
+func parentOf(dir, elem string) string {
+	ss := strings.Split(dir, string(filepath.Separator))
+	for i := len(ss) - 1; i > 0; i-- {
+		if ss[i] == elem {
+			return strings.Join(ss[:i], string(filepath.Separator))
+		}
+	}
+	return dir
+}
+
+// inTree - dir is root or it is inside of root
+func inTree(dir, root string) bool {
+	return dir == root || strings.HasPrefix(dir, root+string(filepath.Separator))
+}
+
+// canonicalPath - import path of vendored package: path after the last "vendor" element
+func canonicalPath(importPath string) string {
+	ss := strings.Split(importPath, "/")
+	for i := len(ss) - 1; i >= 0; i-- {
+		if ss[i] == "vendor" {
+			return strings.Join(ss[i+1:], "/")
+		}
+	}
+	return importPath
+}
+
+// GetImportPaths - import paths available for package in dir:
+// of modules if dir is inside of Go module, otherwise of GOROOT and GOPATH
+// Packages are matched by build constraints of build.Default.
+// Only packages visible from dir are returned, vendored ones by canonical paths.
+func GetImportPaths(ctx context.Context, dir string) ([]string, error) {
+	roots, err := importRoots(dir)
+	if err != nil {
+		return nil, err
+	}
+	bctx := NewBuildContext("", "", nil)
+	load := func(dir string, files []string) (string, []string, error) {
+		return matchPackage(bctx, dir, files)
+	}
+
+	var pkgs []Package
+	for _, root := range roots {
+		pkgs, err = collectPackages(ctx, pkgs, root, ioutil.ReadDir, load)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return visiblePaths(pkgs, dir)
+}
+
+// visiblePaths - unique import paths of packages visible from dir (see VisibleFrom)
+func visiblePaths(pkgs []Package, dir string) ([]string, error) {
+	dir, err := absDir(dir)
+	if err != nil {
+		return nil, err
+	}
 	var imports []string
-	for p := range parseDir(path.Join(build.Default.GOROOT, "src"), skipVendor) {
-		if p.err != nil {
-			return nil, fmt.Errorf("Error on parse dir (%s): %v", build.Default.GOROOT, p.err)
+	seen := make(map[string]bool)
+	for _, p := range pkgs {
+		if p.VisibleFrom(dir) && !seen[p.Path] {
+			seen[p.Path] = true
+			imports = append(imports, p.Path)
+		}
+	}
+	return imports, nil
+}
+
+// absDir - absolute dir, empty one is kept
+func absDir(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrap(err, "error on get abs path")
+	}
+	return dir, nil
+}
+
+// GetAllImportPaths - import paths of GOROOT and GOPATH
+func GetAllImportPaths(ctx context.Context) ([]string, error) {
+	return GetImportPaths(ctx, "")
+}
+
+// Kinds of importRoot
+const (
+	rootGoroot     = "goroot"
+	rootGopath     = "gopath"
+	rootModule     = "module"
+	rootMainModule = "main_module" // its vendor directory is used
+)
+
+// importRoot - directory with packages
+type importRoot struct {
+	Kind   string `json:"kind"`
+	Dir    string `json:"dir"`
+	Prefix string `json:"prefix"` // prefix of import paths, module path for modules
+}
+
+func (r importRoot) overrides() []importFuncOverride {
+	switch r.Kind {
+	case rootGoroot:
+		return []importFuncOverride{skipVendor}
+	case rootModule:
+		return []importFuncOverride{skipVendor, skipNestedModules}
+	case rootMainModule:
+		return []importFuncOverride{skipNestedModules}
+	}
+	return nil
+}
+
+func gorootRoot() importRoot {
+	return importRoot{Kind: rootGoroot, Dir: path.Join(build.Default.GOROOT, "src")}
+}
+
+// importRoots - roots of packages available for package in dir:
+// of modules if dir is inside of Go module, otherwise of GOROOT and GOPATH
+// Roots which do not exist are skipped.
+func importRoots(dir string) ([]importRoot, error) {
+	roots := []importRoot{
+		gorootRoot(),
+		{Kind: rootGopath, Dir: path.Join(build.Default.GOPATH, "src")},
+	}
+	if dir != "" {
+		m, err := FindModule(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on find module")
+		}
+		if m != nil {
+			roots = append([]importRoot{gorootRoot()}, m.Roots()...)
+		}
+	}
+
+	var out []importRoot
+	for _, r := range roots {
+		if isDir(r.Dir) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// packageNames - names of packages of import paths available for package in dir
+// Package is looked up in roots of dir (see importRoots), the longest prefix of
+// module wins, and its name is taken from package clauses of its files.
+// Import paths of packages which are not found are absent in result.
+func packageNames(dir string, paths []string) (map[string]string, error) {
+	names := make(map[string]string)
+	if len(paths) == 0 {
+		return names, nil
+	}
+	roots, err := importRoots(dir)
+	if err != nil {
+		return nil, err
+	}
+	bctx := NewBuildContext("", "", nil)
+	for _, p := range paths {
+		if _, ok := names[p]; ok {
+			continue
+		}
+		if name := packageName(bctx, roots, p); name != "" {
+			names[p] = name
+		}
+	}
+	return names, nil
+}
+
+// packageName - name of package of import path in roots, "" if it is not found
+func packageName(bctx *build.Context, roots []importRoot, importPath string) string {
+	type candidate struct {
+		dir       string
+		prefixLen int
+	}
+	var cc []candidate
+	for _, r := range roots {
+		switch {
+		case r.Prefix == "", importPath == r.Prefix, strings.HasPrefix(importPath, r.Prefix+"/"):
+			rel := strings.TrimPrefix(importPath, r.Prefix)
+			cc = append(cc, candidate{dir: filepath.Join(r.Dir, filepath.FromSlash(rel)), prefixLen: len(r.Prefix)})
+		}
+		if r.Kind == rootMainModule {
+			// vendored package is used instead of ones of modules
+			cc = append(cc, candidate{dir: filepath.Join(r.Dir, "vendor", filepath.FromSlash(importPath)), prefixLen: len(importPath) + 1})
 		}
+	}
+	sort.SliceStable(cc, func(i, j int) bool { return cc[i].prefixLen > cc[j].prefixLen })
 
-		imports = append(imports, p.path)
+	for _, c := range cc {
+		files, err := goFiles(c.dir)
+		if err != nil {
+			continue
+		}
+		var pkgFiles []string
+		for _, f := range files {
+			if !strings.HasSuffix(f, "_test.go") {
+				pkgFiles = append(pkgFiles, f)
+			}
+		}
+		name, _, err := matchPackage(bctx, c.dir, pkgFiles)
+		if err == nil && name != "" {
+			return name
+		}
 	}
+	return ""
+}
 
-	for p := range parseDir(path.Join(build.Default.GOPATH, "src")) {
+// collectPackages - append packages found in root to pkgs
+// Packages without files matched by build constraints are skipped.
+func collectPackages(ctx context.Context, pkgs []Package, root importRoot, readDir readDirFunc, load loadBuildFunc) ([]Package, error) {
+	oo := append([]importFuncOverride{withBuild(load)}, root.overrides()...)
+	for p := range parseDirWith(ctx, readDir, root.Dir, oo...) {
 		if p.err != nil {
-			return nil, fmt.Errorf("Error on parse dir (%s): %v", build.Default.GOPATH, p.err)
+			return nil, errors.Wrapf(p.err, "error on parse dir (%s)", root.Dir)
 		}
 
-		imports = append(imports, p.path)
+		pkgs = append(pkgs, newPackage(root, p))
 	}
 
-	return imports, nil
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// newPackage - package of import path found in root
+func newPackage(root importRoot, p importPath) Package {
+	pkg := Package{
+		Path:     path.Join(root.Prefix, p.path),
+		Name:     p.name,
+		Dir:      filepath.Join(root.Dir, p.path),
+		Main:     p.isMain,
+		Internal: p.isInternal,
+		Vendor:   p.isVendor,
+	}
+	if p.isVendor {
+		pkg.Path = canonicalPath(p.path)
+	}
+	return pkg
 }
 
 type importFunc func(i importPath)
@@ -53,58 +306,106 @@ type importPath struct {
 	path string
 	err  error
 
-	isVendor bool
+	isVendor   bool
+	isInternal bool
+	isMain     bool // filled only by withBuild
+
+	// files - names of '.go' files of package (without tests),
+	// withBuild keeps only files matched by build constraints
+	files []string
+	// name and exports - name of package and its exported identifiers,
+	// name is filled by withBuild or withExports, exports - by withExports
+	name    string
+	exports []string
+
+	// moduleDepth - count of go.mod files in dir and its parents (inside of walked dir)
+	moduleDepth int
 }
 
-func parseDir(pathDir string, oo ...importFuncOverride) <-chan importPath {
+// readDirFunc - list directory, only Name and IsDir of entries are used
+type readDirFunc func(dirname string) ([]os.FileInfo, error)
+
+// parseDir - walk pathDir in background and send found import paths
+// Walk is stopped with ctx.Err() as the last result when ctx is done.
+func parseDir(ctx context.Context, pathDir string, oo ...importFuncOverride) <-chan importPath {
+	return parseDirWith(ctx, ioutil.ReadDir, pathDir, oo...)
+}
+
+// parseDirWith - parseDir which lists directories with readDir
+func parseDirWith(ctx context.Context, readDir readDirFunc, pathDir string, oo ...importFuncOverride) <-chan importPath {
 	out := make(chan importPath)
 
 	cropIndex := len(pathDir) + 1
 	sendImportFunc := override(func(i importPath) {
-		i.path = i.path[cropIndex:]
-		out <- i
+		if len(i.path) < cropIndex {
+			// walked dir itself
+			i.path = ""
+		} else {
+			i.path = i.path[cropIndex:]
+		}
+		select {
+		case out <- i:
+		case <-ctx.Done():
+		}
 	}, oo...)
 
 	go func() {
-		err := parsingDir(pathDir, sendImportFunc)
+		err := parsingDir(ctx, readDir, pathDir, sendImportFunc)
 		if err != nil {
-			out <- importPath{err: err}
+			select {
+			case out <- importPath{err: err}:
+			case <-ctx.Done():
+			}
 		}
 		close(out)
 	}()
 	return out
 }
 
-func parsingDir(pathDir string, fn importFunc) error {
-	fs, err := ioutil.ReadDir(pathDir)
+func parsingDir(ctx context.Context, readDir readDirFunc, pathDir string, fn importFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fs, err := readDir(pathDir)
 	if err != nil {
 		return err
 	}
+	for _, f := range fs {
+		if !f.IsDir() && f.Name() == "go.mod" {
+			fn = inModule(fn)
+			break
+		}
+	}
+
 	// current dir has '.go' files
-	var name string
+	var files []string
 	for _, f := range fs {
 		if f.IsDir() {
 			continue
 		}
-		name = f.Name()
+		name := f.Name()
 		if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
-			fn(importPath{path: pathDir})
-			break
+			files = append(files, name)
 		}
 	}
+	if len(files) > 0 {
+		fn(importPath{path: pathDir, files: files})
+	}
 
 	// walk dirs
 	for _, f := range fs {
 		if !f.IsDir() {
 			continue
 		}
-		switch f.Name() {
-		case "testdata", "cmd":
-			// skip
-		case "vendor":
-			err = parsingDir(path.Join(pathDir, f.Name()), vendor(fn))
+		switch name := f.Name(); {
+		case name == "testdata", strings.HasPrefix(name, "."), strings.HasPrefix(name, "_"):
+			// skip as go tool does
+		case name == "vendor":
+			err = parsingDir(ctx, readDir, path.Join(pathDir, f.Name()), vendor(fn))
+		case name == "internal":
+			err = parsingDir(ctx, readDir, path.Join(pathDir, f.Name()), internal(fn))
 		default:
-			err = parsingDir(path.Join(pathDir, f.Name()), fn)
+			err = parsingDir(ctx, readDir, path.Join(pathDir, f.Name()), fn)
 		}
 		if err != nil {
 			return err
@@ -119,3 +420,17 @@ func vendor(fn importFunc) importFunc {
 		fn(i)
 	}
 }
+
+func internal(fn importFunc) importFunc {
+	return func(i importPath) {
+		i.isInternal = true
+		fn(i)
+	}
+}
+
+func inModule(fn importFunc) importFunc {
+	return func(i importPath) {
+		i.moduleDepth++
+		fn(i)
+	}
+}
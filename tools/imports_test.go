@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"go/build"
 	"os"
 	"path/filepath"
@@ -12,7 +13,7 @@ func test_parseDir(t *testing.T) {
 	for _ = range parseDirWalk(build.Default.GOROOT) {
 		i++
 	}
-	for _ = range parseDir(build.Default.GOROOT) {
+	for _ = range parseDir(context.Background(), build.Default.GOROOT) {
 		j++
 	}
 	if i != j {
@@ -29,7 +30,7 @@ func BenchmarkParseDir_Walk(b *testing.B) {
 
 func BenchmarkParseIoutilDir(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		for _ = range parseDir(build.Default.GOROOT) {
+		for _ = range parseDir(context.Background(), build.Default.GOROOT) {
 		}
 	}
 }
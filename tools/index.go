@@ -0,0 +1,566 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IndexStatus - status of import paths in Index
+type IndexStatus string
+
+// Statuses of Index
+const (
+	// IndexBuilding - first walk is in progress, there are no import paths yet
+	IndexBuilding IndexStatus = "building"
+	// IndexReady - import paths are refreshed recently
+	IndexReady IndexStatus = "ready"
+	// IndexStale - import paths may be outdated, refresh is needed or in progress
+	IndexStale IndexStatus = "stale"
+)
+
+// Index - persistent index of import paths
+//
+// Listings of directories are stored on disk with their mtimes.
+// On refresh only directories with changed mtime are listed again,
+// others are checked by stat, so refresh is much cheaper than full walk.
+type Index struct {
+	// Background - refresh roots in background, queries are answered
+	// with last known import paths (for long-lived processes)
+	Background bool
+	// MaxAge - age of import paths after which root is refreshed
+	MaxAge time.Duration
+	// Build - build constraints of packages, NewBuildContext by default
+	// It is set before the first use of index and is not changed later.
+	Build *build.Context
+
+	filename string
+
+	mu    sync.Mutex
+	roots map[string]*indexRoot // key of root -> root
+	dirs  map[string]indexDir   // dir -> its listing
+	pkgs  map[string]indexPkg   // dir -> exports of package
+	build map[string]indexBuild // dir -> files matched by build constraints
+	uses  map[string]indexUses  // dir -> imports of files
+	dirty bool
+
+	modUses map[string]*moduleUses // root of module -> count of imports, it is not saved
+
+}
+
+type indexRoot struct {
+	importRoot
+	Packages []Package `json:"packages"`
+	Updated  time.Time `json:"updated"`
+
+	refreshing bool
+	checked    bool // refreshed by current process, loaded paths may be outdated
+	walkMu     sync.Mutex
+}
+
+type indexDir struct {
+	ModTime time.Time    `json:"mtime"`
+	Entries []indexEntry `json:"entries"`
+}
+
+// indexEntry - entry of directory listing, it implements os.FileInfo for parsingDir
+type indexEntry struct {
+	N string `json:"n"`
+	D bool   `json:"d,omitempty"`
+}
+
+func (e indexEntry) Name() string { return e.N }
+func (e indexEntry) IsDir() bool  { return e.D }
+func (e indexEntry) Size() int64  { return 0 }
+func (e indexEntry) Mode() os.FileMode {
+	if e.D {
+		return os.ModeDir
+	}
+	return 0
+}
+func (e indexEntry) ModTime() time.Time { return time.Time{} }
+func (e indexEntry) Sys() interface{}   { return nil }
+
+// indexFile - content of file of Index
+type indexFile struct {
+	Version int                   `json:"version"`
+	Roots   map[string]*indexRoot `json:"roots"`
+	Dirs    map[string]indexDir   `json:"dirs"`
+	Pkgs    map[string]indexPkg   `json:"pkgs"`
+	Build   map[string]indexBuild `json:"build"`
+	Uses    map[string]indexUses  `json:"uses"`
+}
+
+const indexFileVersion = 6
+
+// DefaultIndexMaxAge - default MaxAge of Index
+const DefaultIndexMaxAge = time.Minute
+
+// DefaultIndexFile - path of index file in user cache dir
+func DefaultIndexFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "golime", "index.json")
+}
+
+// NewIndex - index stored in filename, it is loaded if file exists
+// Broken or outdated file is ignored and index is rebuilt.
+func NewIndex(filename string) *Index {
+	x := &Index{
+		MaxAge:   DefaultIndexMaxAge,
+		Build:    NewBuildContext("", "", nil),
+		filename: filename,
+		roots:    make(map[string]*indexRoot),
+		dirs:     make(map[string]indexDir),
+		pkgs:     make(map[string]indexPkg),
+		build:    make(map[string]indexBuild),
+		uses:     make(map[string]indexUses),
+		modUses:  make(map[string]*moduleUses),
+	}
+
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return x
+	}
+	var f indexFile
+	if json.Unmarshal(bs, &f) != nil || f.Version != indexFileVersion {
+		return x
+	}
+	for key, r := range f.Roots {
+		x.roots[key] = r
+	}
+	for dir, d := range f.Dirs {
+		x.dirs[dir] = d
+	}
+	for dir, p := range f.Pkgs {
+		x.pkgs[dir] = p
+	}
+	for dir, b := range f.Build {
+		x.build[dir] = b
+	}
+	for dir, u := range f.Uses {
+		x.uses[dir] = u
+	}
+	return x
+}
+
+// ImportPaths - import paths available for package in dir (see GetImportPaths)
+// Root which was never walked is walked before return.
+func (x *Index) ImportPaths(ctx context.Context, dir string) ([]string, error) {
+	pkgs, err := x.Packages(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return visiblePaths(pkgs, dir)
+}
+
+// Packages - all packages of roots available for package in dir (including main ones)
+func (x *Index) Packages(ctx context.Context, dir string) ([]Package, error) {
+	var pkgs []Package
+	err := x.rootPackages(ctx, dir, func(_ importRoot, rootPkgs []Package) {
+		pkgs = append(pkgs, rootPkgs...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// Search - import paths available for package in dir ranked by query (see SearchImports)
+func (x *Index) Search(ctx context.Context, dir, query string, limit int) ([]ImportCandidate, error) {
+	uses, err := x.ImportUses(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := absDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var cc []ImportCandidate
+	seen := make(map[string]bool)
+	err = x.rootPackages(ctx, dir, func(ir importRoot, pkgs []Package) {
+		for _, p := range pkgs {
+			if !p.VisibleFrom(abs) || seen[p.Path] {
+				continue
+			}
+			seen[p.Path] = true
+			cc = append(cc, ImportCandidate{
+				Path:   p.Path,
+				Name:   p.Name,
+				Stdlib: ir.Kind == rootGoroot,
+				Uses:   uses[p.Path],
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return SearchImports(cc, query, limit), nil
+}
+
+// rootPackages - call fn with packages of each root available for package in dir
+func (x *Index) rootPackages(ctx context.Context, dir string, fn func(ir importRoot, pkgs []Package)) error {
+	roots, err := importRoots(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, ir := range roots {
+		r := x.root(ir)
+
+		x.mu.Lock()
+		pkgs, updated, checked := r.Packages, r.Updated, r.checked
+		x.mu.Unlock()
+
+		switch {
+		case updated.IsZero() || !x.Background:
+			pkgs, err = x.refresh(ctx, r)
+			if err != nil {
+				return err
+			}
+		case !checked || time.Since(updated) > x.MaxAge:
+			go x.refreshBackground(r)
+		}
+		fn(ir, pkgs)
+	}
+
+	err = x.Save()
+	if err != nil {
+		return errors.Wrap(err, "error on save index")
+	}
+	return nil
+}
+
+// Refresh - refresh all known roots
+// Root which does not exist anymore is removed from index.
+// Errors of roots are collected, other roots are refreshed anyway.
+func (x *Index) Refresh(ctx context.Context) error {
+	x.mu.Lock()
+	keys := make([]string, 0, len(x.roots))
+	roots := make(map[string]*indexRoot, len(x.roots))
+	for key, r := range x.roots {
+		keys = append(keys, key)
+		roots[key] = r
+	}
+	x.mu.Unlock()
+	sort.Strings(keys)
+
+	var errs []string
+	for _, key := range keys {
+		r := roots[key]
+		if _, err := os.Stat(r.Dir); os.IsNotExist(err) {
+			x.removeRoot(key, r)
+			continue
+		}
+		_, err := x.refresh(ctx, r)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	err := x.Save()
+	if err != nil {
+		return errors.Wrap(err, "error on save index")
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("error on refresh roots: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// removeRoot - forget root and its directories
+func (x *Index) removeRoot(key string, r *indexRoot) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.roots, key)
+	for dir := range x.dirs {
+		if dir == r.Dir || strings.HasPrefix(dir, r.Dir+string(filepath.Separator)) {
+			delete(x.dirs, dir)
+			delete(x.pkgs, dir)
+			delete(x.build, dir)
+			delete(x.uses, dir)
+		}
+	}
+	x.dirty = true
+}
+
+// KeepWarm - refresh known roots every MaxAge until ctx is done
+func (x *Index) KeepWarm(ctx context.Context) {
+	t := time.NewTicker(x.MaxAge)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			x.Refresh(ctx) // nolint: errcheck
+		}
+	}
+}
+
+// IndexRootStatus - status of root of Index
+type IndexRootStatus struct {
+	Dir      string      `json:"dir"`
+	Prefix   string      `json:"prefix,omitempty"`
+	Status   IndexStatus `json:"status"`
+	Packages int         `json:"packages"`
+	Updated  time.Time   `json:"updated"`
+}
+
+// Status - status of index and of each its root
+// Index is building if any root is building, stale if any root is stale.
+func (x *Index) Status() (IndexStatus, []IndexRootStatus) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	status := IndexReady
+	var roots []IndexRootStatus
+	for _, r := range x.roots {
+		rs := IndexRootStatus{
+			Dir:      r.Dir,
+			Prefix:   r.Prefix,
+			Status:   x.rootStatus(r),
+			Packages: len(r.Packages),
+			Updated:  r.Updated,
+		}
+		switch {
+		case rs.Status == IndexBuilding:
+			status = IndexBuilding
+		case rs.Status == IndexStale && status == IndexReady:
+			status = IndexStale
+		}
+		roots = append(roots, rs)
+	}
+	return status, roots
+}
+
+func (x *Index) rootStatus(r *indexRoot) IndexStatus {
+	switch {
+	case r.Updated.IsZero():
+		return IndexBuilding
+	case !r.checked || r.refreshing || time.Since(r.Updated) > x.MaxAge:
+		return IndexStale
+	}
+	return IndexReady
+}
+
+// Save - write index into its file if it is changed
+func (x *Index) Save() error {
+	x.mu.Lock()
+	if !x.dirty {
+		x.mu.Unlock()
+		return nil
+	}
+	bs, err := json.Marshal(indexFile{Version: indexFileVersion, Roots: x.roots, Dirs: x.dirs, Pkgs: x.pkgs, Build: x.build, Uses: x.uses})
+	x.dirty = false
+	x.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "error on marshal index")
+	}
+
+	err = os.MkdirAll(filepath.Dir(x.filename), 0700)
+	if err != nil {
+		return errors.Wrap(err, "error on create index dir")
+	}
+	// write and rename, so other processes never read partial file
+	// and concurrent saves do not write into the same temp file
+	tmp, err := os.CreateTemp(filepath.Dir(x.filename), filepath.Base(x.filename)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "error on create temp index file")
+	}
+	_, err = tmp.Write(bs)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "error on write index")
+	}
+	err = os.Rename(tmp.Name(), x.filename)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "error on rename index file")
+	}
+	return nil
+}
+
+// root - root of index by import root and build context,
+// packages of the same dir differ for other GOOS, GOARCH or tags
+func (x *Index) root(ir importRoot) *indexRoot {
+	key := buildKey(x.Build) + ":" + ir.Kind + ":" + ir.Prefix + ":" + ir.Dir
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	r, ok := x.roots[key]
+	if !ok {
+		r = &indexRoot{importRoot: ir}
+		x.roots[key] = r
+		x.dirty = true
+	}
+	return r
+}
+
+func (x *Index) refreshBackground(r *indexRoot) {
+	x.mu.Lock()
+	if r.refreshing {
+		x.mu.Unlock()
+		return
+	}
+	r.refreshing = true
+	x.mu.Unlock()
+
+	x.refresh(context.Background(), r) // nolint: errcheck
+	x.Save()                           // nolint: errcheck
+}
+
+// refresh - walk root with cached listings of unchanged directories
+func (x *Index) refresh(ctx context.Context, r *indexRoot) ([]Package, error) {
+	r.walkMu.Lock()
+	defer r.walkMu.Unlock()
+	defer func() {
+		x.mu.Lock()
+		r.refreshing = false
+		x.mu.Unlock()
+	}()
+
+	visited := make(map[string]bool)
+	readDir := func(dir string) ([]os.FileInfo, error) {
+		visited[dir] = true
+		return x.readDir(dir)
+	}
+	pkgs, err := collectPackages(ctx, nil, r.importRoot, readDir, x.loadBuild)
+	if err != nil {
+		return nil, err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	// forget removed directories
+	for dir := range x.dirs {
+		if !visited[dir] && strings.HasPrefix(dir, r.Dir+string(filepath.Separator)) {
+			delete(x.dirs, dir)
+			delete(x.pkgs, dir)
+			delete(x.build, dir)
+			delete(x.uses, dir)
+			x.dirty = true
+		}
+	}
+	// unchanged root is not saved again only for new time of update
+	if r.Updated.IsZero() || !reflect.DeepEqual(r.Packages, pkgs) {
+		x.dirty = true
+	}
+	r.Packages = pkgs
+	r.Updated = time.Now()
+	r.checked = true
+	return pkgs, nil
+}
+
+// readDir - listing of dir from cache if mtime of dir is not changed
+func (x *Index) readDir(dir string) ([]os.FileInfo, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	x.mu.Lock()
+	cached, ok := x.dirs[dir]
+	x.mu.Unlock()
+	if ok && cached.ModTime.Equal(fi.ModTime()) {
+		return cached.fileInfos(), nil
+	}
+
+	fs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	d := indexDir{ModTime: fi.ModTime()}
+	for _, f := range fs {
+		d.Entries = append(d.Entries, indexEntry{N: f.Name(), D: f.IsDir()})
+	}
+
+	x.mu.Lock()
+	x.dirs[dir] = d
+	x.dirty = true
+	x.mu.Unlock()
+	return fs, nil
+}
+
+func (d indexDir) fileInfos() []os.FileInfo {
+	out := make([]os.FileInfo, len(d.Entries))
+	for i, e := range d.Entries {
+		out[i] = e
+	}
+	return out
+}
+
+// indexBuild - cached files of package matched by build constraints
+type indexBuild struct {
+	ModTime time.Time `json:"mtime"` // the latest mtime of files
+	Files   []string  `json:"files"`
+	Context string    `json:"ctx"` // key of build context
+	Name    string    `json:"name"`
+	Matched []string  `json:"matched"`
+}
+
+// loadBuild - matched files of package from cache if its files are not changed
+// Packages with unsaved files are matched every time and are not cached.
+func (x *Index) loadBuild(dir string, files []string) (string, []string, error) {
+	modTime, overlaid, err := filesModTime(dir, files)
+	if err != nil {
+		return "", nil, err
+	}
+	bctx := x.Build
+	key := buildKey(bctx)
+
+	x.mu.Lock()
+	cached, ok := x.build[dir]
+	x.mu.Unlock()
+	if !overlaid && ok && cached.Context == key && cached.ModTime.Equal(modTime) && equalStrings(cached.Files, files) {
+		return cached.Name, cached.Matched, nil
+	}
+
+	name, matched, err := matchPackage(bctx, dir, files)
+	if err != nil {
+		return "", nil, err
+	}
+	if !overlaid {
+		x.mu.Lock()
+		x.build[dir] = indexBuild{ModTime: modTime, Files: files, Context: key, Name: name, Matched: matched}
+		x.dirty = true
+		x.mu.Unlock()
+	}
+	return name, matched, nil
+}
+
+// filesModTime - the latest mtime of files of dir and if any of them is in overlay
+func filesModTime(dir string, files []string) (time.Time, bool, error) {
+	var modTime time.Time
+	var overlaid bool
+	for _, f := range files {
+		filename := filepath.Join(dir, f)
+		if _, ok := DefaultOverlay.Get(filename); ok {
+			overlaid = true
+		}
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	return modTime, overlaid, nil
+}
@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIndexRefresh(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "golime_index")
+	if err != nil {
+		t.Fatalf("Error on create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	src := filepath.Join(tmpDir, "src")
+	writeGoFile := func(pkg string) {
+		dir := filepath.Join(src, pkg)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("Error on create dir: %v", err)
+		}
+		err := ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0600)
+		if err != nil {
+			t.Fatalf("Error on write file: %v", err)
+		}
+	}
+	writeGoFile("a")
+
+	indexFile := filepath.Join(tmpDir, "index.json")
+	root := importRoot{Kind: rootGopath, Dir: src}
+
+	x := NewIndex(indexFile)
+	if status, _ := x.Status(); status != IndexReady {
+		t.Errorf("Wrong status of empty index: %v", status)
+	}
+	pkgs, err := x.refresh(context.Background(), x.root(root))
+	if err != nil {
+		t.Fatalf("Error on refresh: %v", err)
+	}
+	if paths, _ := visiblePaths(pkgs, ""); !reflect.DeepEqual(paths, []string{"a"}) {
+		t.Errorf("Wrong paths: %v", paths)
+	}
+	if err = x.Save(); err != nil {
+		t.Fatalf("Error on save: %v", err)
+	}
+
+	writeGoFile("a/b")
+
+	// loaded index knows listing of "src", but "src/a" is changed
+	x = NewIndex(indexFile)
+	if status, roots := x.Status(); status != IndexStale || len(roots) != 1 || roots[0].Packages != 1 {
+		t.Errorf("Wrong status of loaded index: %v %v", status, roots)
+	}
+	pkgs, err = x.refresh(context.Background(), x.root(root))
+	if err != nil {
+		t.Fatalf("Error on refresh: %v", err)
+	}
+	if paths, _ := visiblePaths(pkgs, ""); !reflect.DeepEqual(paths, []string{"a", "a/b"}) {
+		t.Errorf("Wrong paths after change: %v", paths)
+	}
+	if status, _ := x.Status(); status != IndexReady {
+		t.Errorf("Wrong status after refresh: %v", status)
+	}
+	if err = x.Save(); err != nil {
+		t.Fatalf("Error on save: %v", err)
+	}
+
+	// unchanged root does not make index dirty
+	_, err = x.refresh(context.Background(), x.root(root))
+	if err != nil {
+		t.Fatalf("Error on refresh: %v", err)
+	}
+	if x.dirty {
+		t.Errorf("Index is dirty after refresh without changes")
+	}
+	tmps, _ := filepath.Glob(filepath.Join(tmpDir, "*.tmp"))
+	if len(tmps) != 0 {
+		t.Errorf("Temp files of index are left: %v", tmps)
+	}
+}
+
+func TestIndexRefreshRemovedRoot(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "golime_index")
+	if err != nil {
+		t.Fatalf("Error on create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var roots []importRoot
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(tmpDir, name, "src", name)
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("Error on create dir: %v", err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package "+name+"\n"), 0600)
+		if err != nil {
+			t.Fatalf("Error on write file: %v", err)
+		}
+		roots = append(roots, importRoot{Kind: rootGopath, Dir: filepath.Join(tmpDir, name, "src")})
+	}
+
+	indexFile := filepath.Join(tmpDir, "index.json")
+	x := NewIndex(indexFile)
+	for _, ir := range roots {
+		if _, err = x.refresh(context.Background(), x.root(ir)); err != nil {
+			t.Fatalf("Error on refresh: %v", err)
+		}
+	}
+	if err = x.Save(); err != nil {
+		t.Fatalf("Error on save: %v", err)
+	}
+	// packages of other build context are in other root
+	y := NewIndex(indexFile)
+	y.Build = NewBuildContext("windows", "amd64", nil)
+	y.root(roots[0])
+	if _, rs := y.Status(); len(rs) != 3 {
+		t.Errorf("Wrong roots of index with other build context: %v", rs)
+	}
+
+	if err = os.RemoveAll(filepath.Join(tmpDir, "b")); err != nil {
+		t.Fatalf("Error on remove root: %v", err)
+	}
+	if err = x.Refresh(context.Background()); err != nil {
+		t.Fatalf("Error on refresh with removed root: %v", err)
+	}
+	_, rs := x.Status()
+	for _, r := range rs {
+		if r.Dir == roots[1].Dir {
+			t.Errorf("Removed root is left in index: %v", r)
+		}
+	}
+	if len(rs) != 1 {
+		t.Errorf("Wrong roots after refresh: %v", rs)
+	}
+	if len(NewIndex(indexFile).roots) != 1 {
+		t.Errorf("Index with removed root is not saved")
+	}
+}
@@ -0,0 +1,237 @@
+package tools
+
+import (
+	"bytes"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/tools/imports"
+)
+
+// MockOptions - options of Mock
+type MockOptions struct {
+	// Name - name of type of mock, "Mock" with name of interface by default
+	Name string
+	// File - file of mock, which is created or replaced,
+	// "mock_<name of interface>_test.go" in dir of filename by default
+	File string
+	// External - mock is in external test package ("<package>_test")
+	External bool
+}
+
+// mockData - data of mockTemplate
+type mockData struct {
+	Package string
+	Imports []string
+	Sync    string // name of package sync in file of mock
+	Name    string
+	Iface   string
+	Methods []mockMethod
+}
+
+// mockMethod - method of mock with type of its calls
+type mockMethod struct {
+	Method
+	// CallType - type of arguments of call (e.g. MockStoreGetCall)
+	CallType string
+	// CallFields - fields of CallType
+	CallFields []mockField
+	// Calls - field of mock with calls of method
+	Calls string
+}
+
+// mockField - field of type of call with parameter which is its value
+type mockField struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+const mockSignature = "({{range .Params}}{{.Name}} {{.Type}}, {{end}})" +
+	"({{range .Res}}{{.Name}} {{.Type}}, {{end}})"
+
+var mockTemplate = template.Must(template.New("mock").Parse(`// Code generated by golime mock; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{range .Imports}}{{.}}
+{{end}})
+
+// {{.Name}} - mock of {{.Iface}}, it records calls of methods with their arguments.
+// Methods call func fields which are set, zero values are returned otherwise.
+// Mock is safe for concurrent use, while it is used func fields are set by setters
+// (e.g. SetGetFunc), they can be assigned directly only before it is used.
+type {{.Name}} struct {
+	mu {{.Sync}}.Mutex
+{{range .Methods}}
+	// {{.Name}}Func - implementation of {{.Name}}
+	{{.Name}}Func func` + mockSignature + `
+	{{.Calls}} []{{.CallType}}
+{{end}}}
+{{range .Methods}}
+// {{.CallType}} - arguments of call of {{.Name}} of {{$.Name}}
+type {{.CallType}} struct{{if .CallFields}} {
+{{range .CallFields}}{{.Name}} {{.Type}}
+{{end}}}{{else}}{}{{end}}
+
+// {{.Name}} - record call and call {{.Name}}Func
+func ({{.Recv}}) {{.Name}}` + mockSignature + ` {
+	{{.RecvName}}.mu.Lock()
+	{{.RecvName}}.{{.Calls}} = append({{.RecvName}}.{{.Calls}}, {{.CallType}}{ {{range $i, $f := .CallFields}}{{if $i}}, {{end}}{{$f.Name}}: {{$f.Value}}{{end}} })
+	fn := {{.RecvName}}.{{.Name}}Func
+	{{.RecvName}}.mu.Unlock()
+{{if .Res}}	if fn == nil {
+		return
+	}
+	return fn({{.Args}})
+{{else}}	if fn != nil {
+		fn({{.Args}})
+	}
+{{end}}}
+
+// Set{{.Name}}Func - set {{.Name}}Func, it can be called while mock is used
+func ({{.Recv}}) Set{{.Name}}Func(fn func` + mockSignature + `) {
+	{{.RecvName}}.mu.Lock()
+	{{.RecvName}}.{{.Name}}Func = fn
+	{{.RecvName}}.mu.Unlock()
+}
+
+// {{.Name}}Calls - calls of {{.Name}} in order they were made
+func ({{.Recv}}) {{.Name}}Calls() []{{.CallType}} {
+	{{.RecvName}}.mu.Lock()
+	defer {{.RecvName}}.mu.Unlock()
+	return append([]{{.CallType}}(nil), {{.RecvName}}.{{.Calls}}...)
+}
+{{end}}`))
+
+// Mock - edit which writes mock of iface into file of options (see MockOptions).
+// Interface is resolved like by Impl in package of filename, generic one has to be
+// instantiated (e.g. "Store[string, *User]").
+// Mock has func field (e.g. GetFunc) with its locked setter (e.g. SetGetFunc)
+// and method which returns recorded calls (e.g. GetCalls) for each method of interface.
+// If src != nil, it is used as content of filename (see ReadFile).
+func Mock(filename string, src []byte, iface string, opt MockOptions) ([]TextEdit, error) {
+	p, err := loadImplPackage(filename, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, it, err := p.resolve("", iface)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on find methods of interface")
+	}
+	if !it.IsMethodSet() {
+		return nil, errors.Errorf("constraint %s can not be mocked", iface)
+	}
+	if it.NumMethods() == 0 {
+		return nil, errors.Errorf("interface %s has no methods", iface)
+	}
+
+	base := iface
+	if i := strings.IndexByte(base, '['); i >= 0 {
+		base = base[:i]
+	}
+	base = base[strings.LastIndex(base, ".")+1:]
+	if opt.Name == "" {
+		opt.Name = "Mock" + upperFirst(base)
+	}
+	if opt.File == "" {
+		opt.File = filepath.Join(filepath.Dir(filename), "mock_"+strings.Join(splitWords(base), "_")+"_test.go")
+	}
+	pkgName := p.pkg.Name()
+	if opt.External {
+		if !strings.HasSuffix(opt.File, "_test.go") {
+			return nil, errors.Errorf("mock in external test package has to be in _test.go file: %s", opt.File)
+		}
+		if !strings.HasSuffix(pkgName, "_test") {
+			pkgName += "_test"
+		}
+	}
+
+	// types are qualified for new file of mock
+	p.imported = make(map[string]string)
+	p.added = nil
+	p.external = opt.External
+	syncName := p.qualifier(types.NewPackage("sync", "sync"))
+
+	data := mockData{Package: pkgName, Name: opt.Name, Iface: iface, Sync: syncName}
+	generated := map[string]bool{"mu": true}
+	for i := 0; i < it.NumMethods(); i++ {
+		m := it.Method(i)
+		if opt.External && !m.Exported() {
+			return nil, errors.Errorf("unexported method %s can not be mocked in external test package", m.Name())
+		}
+		mm := mockMethod{
+			Method:   Method{Recv: "m *" + opt.Name, Func: p.funcOf(m), RecvName: "m"},
+			CallType: opt.Name + upperFirst(m.Name()) + "Call",
+			Calls:    "calls" + upperFirst(m.Name()),
+		}
+		for _, name := range []string{m.Name() + "Func", "Set" + m.Name() + "Func", m.Name() + "Calls", mm.Calls} {
+			generated[name] = true
+		}
+		data.Methods = append(data.Methods, mm)
+	}
+	for _, m := range data.Methods {
+		if generated[m.Name] {
+			return nil, errors.Errorf("method %s of %s conflicts with generated names of mock", m.Name, iface)
+		}
+	}
+
+	ms := make([]Method, len(data.Methods))
+	for i := range data.Methods {
+		ms[i] = data.Methods[i].Method
+	}
+	p.nameMethods(ms, []string{"m", "fn"}, true, true)
+	for i := range data.Methods {
+		mm := &data.Methods[i]
+		mm.Method = ms[i]
+		for _, v := range mm.Params {
+			mm.CallFields = append(mm.CallFields, mockField{
+				Name:  upperFirst(v.Name),
+				Type:  strings.Replace(v.Type, "...", "[]", 1),
+				Value: v.Name,
+			})
+		}
+	}
+
+	for _, imp := range p.added {
+		line := strconv.Quote(imp.Path)
+		if name := p.imported[imp.Path]; name != assumedPackageName(imp.Path) {
+			line = name + " " + line
+		}
+		data.Imports = append(data.Imports, line)
+	}
+	sort.Strings(data.Imports)
+
+	var buf bytes.Buffer
+	err = mockTemplate.Execute(&buf, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on execute template of mock")
+	}
+	out, err := imports.Process(opt.File, buf.Bytes(), &imports.Options{Comments: true, TabIndent: true, TabWidth: 8, FormatOnly: true})
+	if err != nil {
+		return nil, errors.Wrap(err, "error on format mock")
+	}
+
+	old, err := ReadFile(opt.File, nil)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "error on read file")
+	}
+	return []TextEdit{{File: opt.File, Start: 0, End: len(old), NewText: string(out)}}, nil
+}
+
+// upperFirst - name with upper case first letter
+func upperFirst(name string) string {
+	rs := []rune(name)
+	if len(rs) > 0 {
+		rs[0] = unicode.ToUpper(rs[0])
+	}
+	return string(rs)
+}
@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMock(t *testing.T) {
+	filename := "./testdata/impl/store.go"
+	golden, err := ioutil.ReadFile("./testdata/impl/mock_store_test.go.golden")
+	if err != nil {
+		t.Fatalf("Error on read golden file: %v", err)
+	}
+
+	edits, err := Mock(filename, nil, "Store", MockOptions{})
+	if err != nil {
+		t.Fatalf("Error on mock: %v", err)
+	}
+	if len(edits) != 1 || edits[0].File != "testdata/impl/mock_store_test.go" || edits[0].Start != 0 || edits[0].End != 0 {
+		t.Fatalf("Wrong edits: %v", edits)
+	}
+	if edits[0].NewText != string(golden) {
+		t.Errorf("Result: %s", edits[0].NewText)
+		t.Errorf("Expect: %s", golden)
+	}
+
+	// types of package are qualified in external test package
+	edits, err = Mock(filename, nil, "Cache[string, *Item]", MockOptions{Name: "Cache", External: true})
+	if err != nil {
+		t.Fatalf("Error on mock: %v", err)
+	}
+	for _, s := range []string{
+		"package impl_test\n",
+		"\tGetFunc  func(key string) (item *impl.Item, ok bool)\n",
+		"func (m *Cache) Put(key string, value *impl.Item) {\n",
+	} {
+		if !strings.Contains(edits[0].NewText, s) {
+			t.Errorf("Mock does not contain %q: %s", s, edits[0].NewText)
+		}
+	}
+
+	// names of packages declared in package are not used for imports
+	src, err := ioutil.ReadFile("./testdata/impl/file.go")
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+	src = append(src, "\nvar http, sync = 1, 2\n"...)
+	edits, err = Mock("./testdata/impl/file.go", src, "net/http.Handler", MockOptions{})
+	if err != nil {
+		t.Fatalf("Error on mock: %v", err)
+	}
+	for _, s := range []string{
+		"\thttp2 \"net/http\"\n",
+		"\tsync2 \"sync\"\n",
+		"\tmu sync2.Mutex\n",
+		"ServeHTTP(responseWriter http2.ResponseWriter, request *http2.Request)",
+	} {
+		if !strings.Contains(edits[0].NewText, s) {
+			t.Errorf("Mock does not contain %q: %s", s, edits[0].NewText)
+		}
+	}
+
+	_, err = Mock(filename, nil, "Number", MockOptions{})
+	if err == nil {
+		t.Errorf("Expected error on mock of constraint")
+	}
+}
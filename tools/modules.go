@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// GoModule - parsed go.mod of main module
+type GoModule struct {
+	Dir  string // directory of go.mod
+	File *modfile.File
+}
+
+// Path - module path of main module
+func (m *GoModule) Path() string {
+	if m.File.Module == nil {
+		return ""
+	}
+	return m.File.Module.Mod.Path
+}
+
+// FindModule - find go.mod in dir or in its parents
+// It returns nil without error if dir is not in a module.
+func FindModule(dir string) (*GoModule, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on get abs path")
+	}
+	for {
+		filename := filepath.Join(dir, "go.mod")
+		bs, err := ReadFile(filename, nil)
+		if err == nil {
+			f, err := modfile.Parse(filename, bs, nil)
+			if err != nil {
+				return nil, errors.Wrap(err, "error on parse go.mod")
+			}
+			return &GoModule{Dir: dir, File: f}, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "error on read go.mod")
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Roots - directories of main module, required modules and replace targets
+// Modules which are not downloaded into module cache are skipped.
+func (m *GoModule) Roots() []importRoot {
+	roots := []importRoot{{Kind: rootMainModule, Prefix: m.Path(), Dir: m.Dir}}
+	seen := map[string]bool{m.Path(): true}
+
+	add := func(modPath string, mod module.Version) {
+		if seen[modPath] {
+			return
+		}
+		dir, ok := m.moduleDir(mod)
+		if !ok {
+			return
+		}
+		seen[modPath] = true
+		roots = append(roots, importRoot{Kind: rootModule, Prefix: modPath, Dir: dir})
+	}
+
+	for _, r := range m.File.Require {
+		add(r.Mod.Path, m.replaced(r.Mod))
+	}
+	for _, r := range m.File.Replace {
+		add(r.Old.Path, r.New)
+	}
+	return roots
+}
+
+// replaced - target of replace directive for required module
+func (m *GoModule) replaced(mod module.Version) module.Version {
+	for _, r := range m.File.Replace {
+		if r.Old.Path == mod.Path && (r.Old.Version == "" || r.Old.Version == mod.Version) {
+			return r.New
+		}
+	}
+	return mod
+}
+
+// moduleDir - directory of module version:
+// local directory of replace (without version) or directory in module cache
+func (m *GoModule) moduleDir(mod module.Version) (string, bool) {
+	if mod.Version == "" {
+		dir := mod.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(m.Dir, dir)
+		}
+		return dir, isDir(dir)
+	}
+
+	escPath, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return "", false
+	}
+	escVersion, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return "", false
+	}
+	dir := filepath.Join(ModCacheDir(), filepath.FromSlash(escPath)+"@"+escVersion)
+	return dir, isDir(dir)
+}
+
+// ModCacheDir - directory of module cache: $GOMODCACHE or $GOPATH/pkg/mod
+func ModCacheDir() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := filepath.SplitList(build.Default.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+func isDir(dir string) bool {
+	fi, err := os.Stat(dir)
+	return err == nil && fi.IsDir()
+}
+
+// skipNestedModules - skip packages of other modules inside of walked one
+func skipNestedModules(fn importFunc) importFunc {
+	return func(i importPath) {
+		if i.moduleDepth > 1 {
+			return
+		}
+		fn(i)
+	}
+}
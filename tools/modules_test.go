@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestModuleImportPaths(t *testing.T) {
+	m, err := FindModule("./testdata/mod/a")
+	if err != nil {
+		t.Fatalf("Error on find module: %v", err)
+	}
+	if m == nil || m.Path() != "example.com/mod" {
+		t.Fatalf("Wrong module: %v", m)
+	}
+
+	bctx := NewBuildContext("", "", nil)
+	load := func(dir string, files []string) (string, []string, error) {
+		return matchPackage(bctx, dir, files)
+	}
+	var pkgs []Package
+	for _, root := range m.Roots() {
+		pkgs, err = collectPackages(context.Background(), pkgs, root, ioutil.ReadDir, load)
+		if err != nil {
+			t.Fatalf("Error on collect packages: %v", err)
+		}
+	}
+	imports, err := visiblePaths(pkgs, "./testdata/mod/a")
+	if err != nil {
+		t.Fatalf("Error on visible paths: %v", err)
+	}
+
+	// nested module and replaced dir inside of main module are skipped,
+	// so as package main and package excluded by build tags,
+	// vendored package has canonical path, internal packages of
+	// vendored package and of dependency are not visible
+	expect := []string{
+		"example.com/mod",
+		"example.com/mod/a",
+		"example.com/mod/a/internal/ai",
+		"example.com/mod/cmd/util",
+		"example.com/mod/internal/i",
+		"example.com/v",
+		"example.com/dep/c",
+	}
+	if !reflect.DeepEqual(imports, expect) {
+		t.Errorf("Result: %v", imports)
+		t.Errorf("Expect: %v", expect)
+	}
+
+	// internal package of "a" is visible only inside of "a"
+	imports, err = visiblePaths(pkgs, "./testdata/mod/cmd/util")
+	if err != nil {
+		t.Fatalf("Error on visible paths: %v", err)
+	}
+	expect = []string{
+		"example.com/mod",
+		"example.com/mod/a",
+		"example.com/mod/cmd/util",
+		"example.com/mod/internal/i",
+		"example.com/v",
+		"example.com/dep/c",
+	}
+	if !reflect.DeepEqual(imports, expect) {
+		t.Errorf("Result: %v", imports)
+		t.Errorf("Expect: %v", expect)
+	}
+
+	for _, p := range pkgs {
+		switch p.Path {
+		case "example.com/mod/cmd/tool":
+			if !p.Main || p.Name != "main" {
+				t.Errorf("Wrong main package: %v", p)
+			}
+		case "example.com/mod/internal/i":
+			if !p.Internal || p.Name != "i" {
+				t.Errorf("Wrong internal package: %v", p)
+			}
+		case "example.com/v":
+			if !p.Vendor || p.Name != "v" {
+				t.Errorf("Wrong vendored package: %v", p)
+			}
+		}
+	}
+}
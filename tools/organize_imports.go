@@ -0,0 +1,216 @@
+package tools
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ResolveFunc - import paths of packages named pkgName which export symbol,
+// the best one is the first
+type ResolveFunc func(ctx context.Context, pkgName, symbol string) ([]ImportCandidate, error)
+
+// OrganizeOptions - options of OrganizeImports
+type OrganizeOptions struct {
+	// LocalPrefix - comma separated prefixes of import paths of local group,
+	// module path of file by default
+	LocalPrefix string
+	// Resolve - resolver of missing imports, they are not added if it is nil
+	Resolve ResolveFunc
+}
+
+// OrganizeImports - remove unused imports, add missing ones and group imports:
+// standard library, third-party and local packages
+// Comments of kept imports are kept, declarations `import "C"` are not changed.
+// Result is the edit which replaces old import declarations with new one.
+// If src != nil, it is used as content of file (see ReadFile).
+func OrganizeImports(ctx context.Context, filename string, src []byte, opt OrganizeOptions) ([]TextEdit, error) {
+	src, err := ReadFile(filename, src)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on read file")
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on parse file")
+	}
+
+	b := parseImportBlock(fset, file, src)
+	used := usedPackages(file)
+	err = resolveNames(b.Lines, filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	// keep used imports, blank and dot imports are always used,
+	// import of unknown package is kept, its name may differ from path
+	imported := map[string]bool{"C": b.Cgo}
+	lines := b.Lines[:0]
+	for _, l := range b.Lines {
+		name := l.name()
+		unknown := l.Name == "" && l.Package == ""
+		if name == "_" || name == "." || len(used[name]) > 0 || unknown {
+			lines = append(lines, l)
+			imported[name] = true
+		}
+	}
+	b.Lines = lines
+
+	if opt.Resolve != nil {
+		declared, err := packageDecls(filename, file)
+		if err != nil {
+			return nil, err
+		}
+		var missing []string
+		for name := range used {
+			if !imported[name] && !declared[name] {
+				missing = append(missing, name)
+			}
+		}
+		sort.Strings(missing)
+		for _, name := range missing {
+			cc, err := opt.Resolve(ctx, name, used[name][0])
+			if err != nil {
+				return nil, errors.Wrapf(err, "error on resolve %q", name)
+			}
+			if len(cc) == 0 {
+				continue
+			}
+			b.add("", cc[0].Path, cc[0].Name)
+		}
+	}
+
+	local := opt.LocalPrefix
+	if local == "" {
+		local, err = localPrefix(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := b.edit(filename, src, local)
+	if res.NewText == string(src[res.Start:res.End]) {
+		return []TextEdit{}, nil
+	}
+	return []TextEdit{res}, nil
+}
+
+// usedPackages - names of unresolved identifiers which are used as packages:
+// name -> sorted selected identifiers
+func usedPackages(file *ast.File) map[string][]string {
+	seen := make(map[string]map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+			if seen[x.Name] == nil {
+				seen[x.Name] = make(map[string]bool)
+			}
+			seen[x.Name][sel.Sel.Name] = true
+		}
+		return true
+	})
+
+	used := make(map[string][]string, len(seen))
+	for name, ss := range seen {
+		for s := range ss {
+			used[name] = append(used[name], s)
+		}
+		sort.Strings(used[name])
+	}
+	return used
+}
+
+// packageDecls - top level names declared in other files of package of file
+// They are unresolved in file, so they can not be names of missing packages.
+func packageDecls(filename string, file *ast.File) (map[string]bool, error) {
+	dir := filepath.Dir(filename)
+	files, err := goFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, f := range files {
+		other := filepath.Join(dir, f)
+		if other == filepath.Clean(filename) {
+			continue
+		}
+		src, err := ReadFile(other, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error on read file")
+		}
+		of, _ := parser.ParseFile(fset, other, src, 0)
+		if of == nil || of.Name.Name != file.Name.Name {
+			continue
+		}
+		for name := range of.Scope.Objects {
+			declared[name] = true
+		}
+	}
+	return declared, nil
+}
+
+// goFiles - names of '.go' files in dir and in overlay (including tests)
+func goFiles(dir string) ([]string, error) {
+	fs, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "error on read dir")
+	}
+	seen := make(map[string]bool)
+	var files []string
+	add := func(name string) {
+		if strings.HasSuffix(name, ".go") && !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+	for _, f := range fs {
+		if !f.IsDir() {
+			add(f.Name())
+		}
+	}
+	for name := range DefaultOverlay.Dir(dir) {
+		add(name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// assumedPackageName - name of package by its import path:
+// last element without "go-" prefix and ".vN" suffix, major version is skipped
+// (e.g. "gopkg.in/yaml.v2" - yaml, "github.com/mattn/go-sqlite3" - sqlite3)
+func assumedPackageName(importPath string) string {
+	ss := strings.Split(importPath, "/")
+	name := ss[len(ss)-1]
+	if len(ss) > 1 && isMajorVersion(name) {
+		name = ss[len(ss)-2]
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.NewReplacer("-", "_", ".", "_").Replace(name)
+}
+
+// isMajorVersion - element of path is major version of module, like "v2"
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOrganizeImports(t *testing.T) {
+	filename := "./testdata/test_organize_imports.go"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+	golden, err := ioutil.ReadFile(filename + ".golden")
+	if err != nil {
+		t.Fatalf("Error on read golden file: %v", err)
+	}
+
+	resolve := func(ctx context.Context, pkgName, symbol string) ([]ImportCandidate, error) {
+		if pkgName == "strings" && symbol == "ToUpper" {
+			return []ImportCandidate{{Path: "strings"}}, nil
+		}
+		return nil, nil
+	}
+	edits, err := OrganizeImports(context.Background(), filename, nil, OrganizeOptions{
+		LocalPrefix: "github.com/vkd/golime",
+		Resolve:     resolve,
+	})
+	if err != nil {
+		t.Fatalf("Error on organize imports: %v", err)
+	}
+	result, err := ApplyEdits(src, edits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	if string(result) != string(golden) {
+		t.Errorf("Result: %s", result)
+		t.Errorf("Expect: %s", golden)
+	}
+
+	// organized file is not changed
+	edits, err = OrganizeImports(context.Background(), filename, golden, OrganizeOptions{LocalPrefix: "github.com/vkd/golime"})
+	if err != nil {
+		t.Fatalf("Error on organize imports: %v", err)
+	}
+	if len(edits) != 0 {
+		t.Errorf("Unexpected edits of organized file: %v", edits)
+	}
+}
+
+func TestOrganizeImportsPackageNames(t *testing.T) {
+	// names of packages differ from last elements of their paths,
+	// unknown package is kept as its name is unknown
+	src := []byte(`package names
+
+import (
+	"os"
+
+	"example.com/names/x/client"
+	"example.com/unknown/pkg"
+	"github.com/influxdata/influxdb1-client/v2"
+	"k8s.io/api/core/v1"
+)
+
+var _ v1.Pod
+var _ client.Client
+var _ = api.X
+`)
+	expect := `package names
+
+import (
+	"example.com/names/x/client"
+	"example.com/unknown/pkg"
+	"github.com/influxdata/influxdb1-client/v2"
+	"k8s.io/api/core/v1"
+)
+
+var _ v1.Pod
+var _ client.Client
+var _ = api.X
+`
+	edits, err := OrganizeImports(context.Background(), "./testdata/names/names.go", src, OrganizeOptions{LocalPrefix: "example.com/other"})
+	if err != nil {
+		t.Fatalf("Error on organize imports: %v", err)
+	}
+	result, err := ApplyEdits(src, edits)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	if string(result) != expect {
+		t.Errorf("Result: %s", result)
+		t.Errorf("Expect: %s", expect)
+	}
+}
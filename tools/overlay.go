@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Overlay - contents of unsaved files (e.g. dirty buffers of editor)
+// Tools read files through DefaultOverlay, so its contents
+// take precedence over files on disk.
+type Overlay struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// DefaultOverlay - overlay used by all tools
+var DefaultOverlay = NewOverlay()
+
+// NewOverlay - create empty overlay
+func NewOverlay() *Overlay {
+	return &Overlay{files: make(map[string][]byte)}
+}
+
+// Set - set content of file
+func (o *Overlay) Set(filename string, content []byte) {
+	o.mu.Lock()
+	o.files[overlayKey(filename)] = content
+	o.mu.Unlock()
+}
+
+// Delete - remove file from overlay, file on disk is used again
+func (o *Overlay) Delete(filename string) {
+	o.mu.Lock()
+	delete(o.files, overlayKey(filename))
+	o.mu.Unlock()
+}
+
+// Get - content of file if it is in overlay
+func (o *Overlay) Get(filename string) ([]byte, bool) {
+	o.mu.RLock()
+	content, ok := o.files[overlayKey(filename)]
+	o.mu.RUnlock()
+	return content, ok
+}
+
+// Dir - overlaid files of directory: base name -> content
+func (o *Overlay) Dir(dir string) map[string][]byte {
+	dir = overlayKey(dir)
+	out := make(map[string][]byte)
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for filename, content := range o.files {
+		if filepath.Dir(filename) == dir {
+			out[filepath.Base(filename)] = content
+		}
+	}
+	return out
+}
+
+// ReadFile - content of file: src if it is not nil,
+// overlaid content or file on disk.
+func (o *Overlay) ReadFile(filename string, src []byte) ([]byte, error) {
+	if src != nil {
+		return src, nil
+	}
+	if content, ok := o.Get(filename); ok {
+		return content, nil
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// ReadFile - read file through DefaultOverlay
+func ReadFile(filename string, src []byte) ([]byte, error) {
+	return DefaultOverlay.ReadFile(filename, src)
+}
+
+func overlayKey(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filepath.Clean(filename)
+	}
+	return abs
+}
+
+// MirrorDir - make temp copy of dir for tools which read files only from disk
+// Files of dir are linked into temp dir, overlaid files (of DefaultOverlay
+// and from src: base name -> content) are written into it.
+// cleanup removes temp dir.
+func MirrorDir(dir string, src map[string][]byte) (tmpDir string, cleanup func(), err error) {
+	tmpDir, err = ioutil.TempDir("", "golime")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "error on create temp dir")
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
+
+	contents := DefaultOverlay.Dir(dir)
+	for name, content := range src {
+		contents[name] = content
+	}
+
+	fs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		cleanup()
+		return "", nil, errors.Wrap(err, "error on read dir")
+	}
+	for _, f := range fs {
+		if f.IsDir() {
+			continue
+		}
+		if _, ok := contents[f.Name()]; ok {
+			continue
+		}
+		err = os.Symlink(filepath.Join(overlayKey(dir), f.Name()), filepath.Join(tmpDir, f.Name()))
+		if err != nil {
+			cleanup()
+			return "", nil, errors.Wrap(err, "error on link file")
+		}
+	}
+	for name, content := range contents {
+		err = ioutil.WriteFile(filepath.Join(tmpDir, name), content, 0600)
+		if err != nil {
+			cleanup()
+			return "", nil, errors.Wrap(err, "error on write overlaid file")
+		}
+	}
+	return tmpDir, cleanup, nil
+}
@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestOverlayReadFile(t *testing.T) {
+	filename := "./testdata/test_one_add_import.go"
+	diskBs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Error on read file: %v", err)
+	}
+
+	o := NewOverlay()
+	for _, tt := range []struct {
+		Name    string
+		Overlay []byte
+		Src     []byte
+		Expect  string
+	}{
+		{"Disk", nil, nil, string(diskBs)},
+		{"Overlay", []byte("package overlay\n"), nil, "package overlay\n"},
+		{"Src", []byte("package overlay\n"), []byte("package src\n"), "package src\n"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			if tt.Overlay != nil {
+				o.Set("testdata/../testdata/test_one_add_import.go", tt.Overlay)
+				defer o.Delete(filename)
+			}
+			bs, err := o.ReadFile(filename, tt.Src)
+			if err != nil {
+				t.Fatalf("Error on read file: %v", err)
+			}
+			if string(bs) != tt.Expect {
+				t.Errorf("Result: %q", bs)
+				t.Errorf("Expect: %q", tt.Expect)
+			}
+		})
+	}
+}
+
+func TestAddImportSrc(t *testing.T) {
+	src := []byte("package test\n\nimport \"fmt\"\n")
+	res, err := AddImport("./testdata/unknown.go", "bytes", src)
+	if err != nil {
+		t.Fatalf("Error on add import: %v", err)
+	}
+	result, err := ApplyEdits(src, res)
+	if err != nil {
+		t.Fatalf("Error on apply edits: %v", err)
+	}
+	expect := "package test\n\nimport (\n\t\"bytes\"\n\t\"fmt\"\n)\n"
+	if string(result) != expect {
+		t.Errorf("Result: %q", result)
+		t.Errorf("Expect: %q", expect)
+	}
+}
@@ -0,0 +1,319 @@
+package tools
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ImportCandidate - import path matched by query
+type ImportCandidate struct {
+	Path   string `json:"path"`
+	Name   string `json:"name,omitempty"` // name of package if it is known
+	Stdlib bool   `json:"stdlib,omitempty"`
+	Uses   int    `json:"uses,omitempty"` // count of imports of path in module
+	Score  int    `json:"score"`          // how well path is matched, greater is better
+}
+
+// Scores of match of import path and query
+const (
+	matchNone = iota
+	matchSubsequence
+	matchPathContains
+	matchLastContains
+	matchPathPrefix
+	matchLastPrefix
+	matchLast
+	matchPath
+)
+
+// SearchImports - candidates matched by query sorted from the best one
+// Candidates are ranked by score of match (last element of path first,
+// then whole path, then subsequence of path), then by uses in module,
+// then standard library first. Empty query matches all candidates.
+// Limit <= 0 means no limit.
+func SearchImports(cc []ImportCandidate, query string, limit int) []ImportCandidate {
+	query = strings.ToLower(query)
+
+	var out []ImportCandidate
+	for _, c := range cc {
+		c.Score = matchScore(strings.ToLower(c.Path), query)
+		if c.Score == matchNone {
+			continue
+		}
+		out = append(out, c)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case a.Uses != b.Uses:
+			return a.Uses > b.Uses
+		case a.Stdlib != b.Stdlib:
+			return a.Stdlib
+		case len(a.Path) != len(b.Path):
+			return len(a.Path) < len(b.Path)
+		}
+		return a.Path < b.Path
+	})
+
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func matchScore(p, query string) int {
+	if query == "" {
+		return matchSubsequence
+	}
+	last := path.Base(p)
+	switch {
+	case p == query:
+		return matchPath
+	case last == query:
+		return matchLast
+	case strings.HasPrefix(last, query):
+		return matchLastPrefix
+	case strings.HasPrefix(p, query):
+		return matchPathPrefix
+	case strings.Contains(last, query):
+		return matchLastContains
+	case strings.Contains(p, query):
+		return matchPathContains
+	case isSubsequence(p, query):
+		return matchSubsequence
+	}
+	return matchNone
+}
+
+// isSubsequence - all bytes of sub are in s in the same order
+func isSubsequence(s, sub string) bool {
+	for i := 0; i < len(s) && len(sub) > 0; i++ {
+		if s[i] == sub[0] {
+			sub = sub[1:]
+		}
+	}
+	return sub == ""
+}
+
+// ImportUses - count of imports of each path in .go files of module of dir
+// If dir is not in a module only files of dir are read.
+func ImportUses(ctx context.Context, dir string) (map[string]int, error) {
+	root, inModule, err := usesRoot(dir)
+	if err != nil || root == "" {
+		return make(map[string]int), err
+	}
+	return importUses(ctx, root, inModule, ioutil.ReadDir, fileImports)
+}
+
+// moduleUses - cached count of imports in module
+type moduleUses struct {
+	uses       map[string]int
+	updated    time.Time
+	refreshing bool
+}
+
+// ImportUses - number of imports of each import path in .go files of module of dir.
+// Unlike the package func, module is not walked on every call:
+// counts of module are cached in memory and are counted again after MaxAge,
+// in background mode the last counts are returned while new ones are counted.
+// Imports of files are cached by directories and are read again only if files are changed.
+// Returned map is shared and must not be changed.
+func (x *Index) ImportUses(ctx context.Context, dir string) (map[string]int, error) {
+	root, inModule, err := usesRoot(dir)
+	if err != nil || root == "" {
+		return make(map[string]int), err
+	}
+
+	x.mu.Lock()
+	cached, ok := x.modUses[root]
+	var fresh, background bool
+	if ok {
+		fresh = time.Since(cached.updated) <= x.MaxAge
+		background = !fresh && x.Background && !cached.refreshing
+		if background {
+			cached.refreshing = true
+		}
+	}
+	x.mu.Unlock()
+
+	switch {
+	case ok && fresh:
+		return cached.uses, nil
+	case ok && x.Background:
+		if background {
+			go func() {
+				x.countUses(context.Background(), root, inModule) // nolint: errcheck
+				x.Save()                                          // nolint: errcheck
+			}()
+		}
+		return cached.uses, nil
+	}
+	return x.countUses(ctx, root, inModule)
+}
+
+// countUses - count imports in module and cache them
+func (x *Index) countUses(ctx context.Context, root string, inModule bool) (map[string]int, error) {
+	uses, err := importUses(ctx, root, inModule, x.readDir, x.loadImports)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if cached, ok := x.modUses[root]; ok {
+		cached.refreshing = false
+	}
+	if err != nil {
+		return nil, err
+	}
+	x.modUses[root] = &moduleUses{uses: uses, updated: time.Now()}
+	return uses, nil
+}
+
+// usesRoot - root of module of dir and true,
+// or dir itself and false if dir is not in a module
+func usesRoot(dir string) (string, bool, error) {
+	if dir == "" {
+		return "", false, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false, errors.Wrap(err, "error on get abs path")
+	}
+	m, err := FindModule(dir)
+	if err != nil {
+		return "", false, errors.Wrap(err, "error on find module")
+	}
+	if m == nil {
+		return dir, false, nil
+	}
+	return m.Dir, true, nil
+}
+
+// importUses - count of imports in root (and its subdirectories if inModule),
+// files of each directory are listed by readDir and their imports are counted by load
+func importUses(ctx context.Context, root string, inModule bool, readDir func(string) ([]os.FileInfo, error), load func(dir string, files []string) (map[string]int, error)) (map[string]int, error) {
+	uses := make(map[string]int)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fs, err := readDir(dir)
+		if err != nil {
+			return err
+		}
+		var files []string
+		for _, f := range fs {
+			switch {
+			case f.IsDir():
+				sub := filepath.Join(dir, f.Name())
+				if !inModule || skipUsesDir(sub, f.Name()) {
+					continue
+				}
+				err = walk(sub)
+				if err != nil {
+					return err
+				}
+			case strings.HasSuffix(f.Name(), ".go"):
+				files = append(files, f.Name())
+			}
+		}
+		imports, err := load(dir, files)
+		if err != nil {
+			return err
+		}
+		for p, n := range imports {
+			uses[p] += n
+		}
+		return nil
+	}
+	err := walk(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on walk module")
+	}
+	return uses, nil
+}
+
+// fileImports - count of imports of each path in files of dir
+func fileImports(dir string, files []string) (map[string]int, error) {
+	imports := make(map[string]int)
+	fset := token.NewFileSet()
+	for _, name := range files {
+		filename := filepath.Join(dir, name)
+		src, err := ReadFile(filename, nil)
+		if err != nil {
+			return nil, err
+		}
+		// imports of file with syntax errors are still counted
+		f, _ := parser.ParseFile(fset, filename, src, parser.ImportsOnly)
+		if f == nil {
+			continue
+		}
+		for _, spec := range f.Imports {
+			p, err := strconv.Unquote(spec.Path.Value)
+			if err == nil {
+				imports[p]++
+			}
+		}
+	}
+	return imports, nil
+}
+
+// indexUses - cached count of imports of files of dir
+type indexUses struct {
+	ModTime time.Time      `json:"mtime"` // the latest mtime of files
+	Files   []string       `json:"files"`
+	Imports map[string]int `json:"imports"`
+}
+
+// loadImports - imports of files of dir from cache if files are not changed
+// Directories with unsaved files are read every time and are not cached.
+func (x *Index) loadImports(dir string, files []string) (map[string]int, error) {
+	modTime, overlaid, err := filesModTime(dir, files)
+	if err != nil {
+		return nil, err
+	}
+
+	x.mu.Lock()
+	cached, ok := x.uses[dir]
+	x.mu.Unlock()
+	if !overlaid && ok && cached.ModTime.Equal(modTime) && equalStrings(cached.Files, files) {
+		return cached.Imports, nil
+	}
+
+	imports, err := fileImports(dir, files)
+	if err != nil {
+		return nil, err
+	}
+	if !overlaid {
+		x.mu.Lock()
+		x.uses[dir] = indexUses{ModTime: modTime, Files: files, Imports: imports}
+		x.dirty = true
+		x.mu.Unlock()
+	}
+	return imports, nil
+}
+
+// skipUsesDir - dir is not a part of module: vendor, testdata, hidden or nested module
+func skipUsesDir(dir, name string) bool {
+	switch {
+	case name == "vendor", name == "testdata":
+		return true
+	case strings.HasPrefix(name, "."), strings.HasPrefix(name, "_"):
+		return true
+	}
+	_, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil
+}
@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchImports(t *testing.T) {
+	cc := []ImportCandidate{
+		{Path: "github.com/x/nethttp"},
+		{Path: "github.com/x/http", Uses: 2},
+		{Path: "net/http", Stdlib: true},
+		{Path: "net/http/httptest", Stdlib: true},
+		{Path: "github.com/y/http"},
+		{Path: "strings", Stdlib: true},
+	}
+	for _, tt := range []struct {
+		Query  string
+		Limit  int
+		Expect []string
+	}{
+		{"http", 0, []string{"github.com/x/http", "net/http", "github.com/y/http", "net/http/httptest", "github.com/x/nethttp"}},
+		{"http", 2, []string{"github.com/x/http", "net/http"}},
+		{"net/http", 0, []string{"net/http", "net/http/httptest"}},
+		{"nhtst", 0, []string{"net/http/httptest"}},
+		{"STR", 0, []string{"strings"}},
+		{"", 3, []string{"github.com/x/http", "strings", "net/http"}},
+	} {
+		t.Run(tt.Query, func(t *testing.T) {
+			var res []string
+			for _, c := range SearchImports(cc, tt.Query, tt.Limit) {
+				res = append(res, c.Path)
+			}
+			if !reflect.DeepEqual(res, tt.Expect) {
+				t.Errorf("Result: %v", res)
+				t.Errorf("Expect: %v", tt.Expect)
+			}
+		})
+	}
+}
+
+func TestImportUses(t *testing.T) {
+	uses, err := ImportUses(context.Background(), "./testdata/mod/a")
+	if err != nil {
+		t.Fatalf("Error on count uses: %v", err)
+	}
+	// files of nested module and of replaced dir are skipped
+	expect := map[string]int{"fmt": 2, "example.com/mod/a": 1}
+	if !reflect.DeepEqual(uses, expect) {
+		t.Errorf("Result: %v", uses)
+		t.Errorf("Expect: %v", expect)
+	}
+}
+
+func TestIndexImportUses(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "golime_uses")
+	if err != nil {
+		t.Fatalf("Error on create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	x := NewIndex(filepath.Join(tmpDir, "index.json"))
+	uses, err := x.ImportUses(context.Background(), "./testdata/mod/a")
+	if err != nil {
+		t.Fatalf("Error on count uses: %v", err)
+	}
+	expect := map[string]int{"fmt": 2, "example.com/mod/a": 1}
+	if !reflect.DeepEqual(uses, expect) {
+		t.Errorf("Result: %v", uses)
+		t.Errorf("Expect: %v", expect)
+	}
+
+	mod := filepath.Join(tmpDir, "mod")
+	writeFile := func(name, content string, modTime time.Time) {
+		filename := filepath.Join(mod, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			t.Fatalf("Error on create dir: %v", err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatalf("Error on write file: %v", err)
+		}
+		if err := os.Chtimes(filename, modTime, modTime); err != nil {
+			t.Fatalf("Error on change mtime: %v", err)
+		}
+	}
+	now := time.Now()
+	writeFile("go.mod", "module example.com/uses\n", now)
+	writeFile("a.go", "package uses\n\nimport \"fmt\"\n", now)
+	writeFile("b/b.go", "package b\n\nimport \"fmt\"\n", now)
+
+	uses, err = x.ImportUses(context.Background(), mod)
+	if err != nil {
+		t.Fatalf("Error on count uses: %v", err)
+	}
+	if expect := map[string]int{"fmt": 2}; !reflect.DeepEqual(uses, expect) {
+		t.Errorf("Wrong uses: %v, expected %v", uses, expect)
+	}
+	if _, ok := x.uses[filepath.Join(mod, "b")]; !ok {
+		t.Errorf("Imports of dir are not cached: %v", x.uses)
+	}
+
+	// counts of module are not counted again until MaxAge
+	writeFile("b/b.go", "package b\n\nimport \"os\"\n", now.Add(time.Hour))
+	uses, err = x.ImportUses(context.Background(), mod)
+	if err != nil {
+		t.Fatalf("Error on count uses: %v", err)
+	}
+	if expect := map[string]int{"fmt": 2}; !reflect.DeepEqual(uses, expect) {
+		t.Errorf("Wrong cached uses: %v, expected %v", uses, expect)
+	}
+
+	// changed file is read again, others are taken from cache
+	x.MaxAge = 0
+	uses, err = x.ImportUses(context.Background(), mod)
+	if err != nil {
+		t.Fatalf("Error on count uses: %v", err)
+	}
+	if expect := map[string]int{"fmt": 1, "os": 1}; !reflect.DeepEqual(uses, expect) {
+		t.Errorf("Wrong uses after change: %v, expected %v", uses, expect)
+	}
+}
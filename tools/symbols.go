@@ -0,0 +1,251 @@
+package tools
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// loadExportsFunc - name of package in dir and its exported identifiers
+type loadExportsFunc func(dir string, files []string) (name string, exports []string, err error)
+
+// withExports - fill name and exports of packages matched by match,
+// other packages and packages which can not be parsed are skipped
+// Name of package is filled before match by outer withBuild.
+func withExports(load loadExportsFunc, match func(i importPath) bool) importFuncOverride {
+	return func(fn importFunc) importFunc {
+		return func(i importPath) {
+			if !match(i) {
+				return
+			}
+			name, exports, err := load(i.path, i.files)
+			if err != nil {
+				return
+			}
+			i.name, i.exports = name, exports
+			fn(i)
+		}
+	}
+}
+
+// PackageExports - name of package and its sorted exported identifiers:
+// functions, types, variables and constants (methods are not included)
+func PackageExports(dir string, files []string) (string, []string, error) {
+	fset := token.NewFileSet()
+	names := make(map[string]int)
+	var name string
+	seen := make(map[string]bool)
+	var exports []string
+	for _, f := range files {
+		filename := filepath.Join(dir, f)
+		src, err := ReadFile(filename, nil)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "error on read file")
+		}
+		file, err := parser.ParseFile(fset, filename, src, 0)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "error on parse file")
+		}
+
+		// the most common name, others are in ignored files usually
+		names[file.Name.Name]++
+		if names[file.Name.Name] > names[name] {
+			name = file.Name.Name
+		}
+
+		for _, id := range exportedIdents(file) {
+			if !seen[id] {
+				seen[id] = true
+				exports = append(exports, id)
+			}
+		}
+	}
+	sort.Strings(exports)
+	return name, exports, nil
+}
+
+func exportedIdents(file *ast.File) []string {
+	var out []string
+	add := func(id *ast.Ident) {
+		if id.IsExported() {
+			out = append(out, id.Name)
+		}
+	}
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				add(d.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name)
+				case *ast.ValueSpec:
+					for _, id := range spec.Names {
+						add(id)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// importPathOf - import path of package in dir of root
+func importPathOf(r importRoot, dir string) string {
+	rel := strings.TrimPrefix(strings.TrimPrefix(dir, r.Dir), string(filepath.Separator))
+	return path.Join(r.Prefix, filepath.ToSlash(rel))
+}
+
+// Resolve - import paths visible from package in dir,
+// packages of which are named pkgName and export symbol
+func (x *Index) Resolve(ctx context.Context, dir, pkgName, symbol string) ([]ImportCandidate, error) {
+	roots, err := importRoots(dir)
+	if err != nil {
+		return nil, err
+	}
+	uses, err := x.ImportUses(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := absDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var cc []ImportCandidate
+	seen := make(map[string]bool)
+	for _, ir := range roots {
+		// name of package is known from cached build constraints,
+		// so only packages named pkgName are parsed for exports
+		match := func(i importPath) bool {
+			return i.name == pkgName
+		}
+		oo := append([]importFuncOverride{withExports(x.loadExports, match), withBuild(x.loadBuild)}, ir.overrides()...)
+		for p := range parseDirWith(ctx, x.readDir, ir.Dir, oo...) {
+			if p.err != nil {
+				return nil, errors.Wrapf(p.err, "error on parse dir (%s)", ir.Dir)
+			}
+			pkg := newPackage(ir, p)
+			if !pkg.VisibleFrom(abs) || p.name != pkgName || seen[pkg.Path] || !containsString(p.exports, symbol) {
+				continue
+			}
+			seen[pkg.Path] = true
+			cc = append(cc, ImportCandidate{
+				Path:   pkg.Path,
+				Name:   p.name,
+				Stdlib: ir.Kind == rootGoroot,
+				Uses:   uses[pkg.Path],
+			})
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	err = x.Save()
+	if err != nil {
+		return nil, errors.Wrap(err, "error on save index")
+	}
+	return SearchImports(cc, "", 0), nil
+}
+
+// containsString - sorted ss contains s
+func containsString(ss []string, s string) bool {
+	i := sort.SearchStrings(ss, s)
+	return i < len(ss) && ss[i] == s
+}
+
+// indexPkg - cached exports of package
+type indexPkg struct {
+	ModTime time.Time `json:"mtime"` // the latest mtime of files
+	Files   []string  `json:"files"`
+	Name    string    `json:"name"`
+	Exports []string  `json:"exports"`
+}
+
+// loadExports - exports of package from cache if its files are not changed
+// Packages with unsaved files are parsed every time and are not cached.
+func (x *Index) loadExports(dir string, files []string) (string, []string, error) {
+	modTime, overlaid, err := filesModTime(dir, files)
+	if err != nil {
+		return "", nil, err
+	}
+
+	x.mu.Lock()
+	cached, ok := x.pkgs[dir]
+	x.mu.Unlock()
+	if !overlaid && ok && cached.ModTime.Equal(modTime) && equalStrings(cached.Files, files) {
+		return cached.Name, cached.Exports, nil
+	}
+
+	name, exports, err := PackageExports(dir, files)
+	if err != nil {
+		return "", nil, err
+	}
+	if !overlaid {
+		x.mu.Lock()
+		x.pkgs[dir] = indexPkg{ModTime: modTime, Files: files, Name: name, Exports: exports}
+		x.dirty = true
+		x.mu.Unlock()
+	}
+	return name, exports, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectorAt - package name and selected identifier of selector expression
+// at byte offset of file (e.g. "sync" and "WaitGroup" of sync.WaitGroup)
+func SelectorAt(filename string, src []byte, offset int) (pkgName, symbol string, err error) {
+	src, err = ReadFile(filename, src)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error on read file")
+	}
+	fset := token.NewFileSet()
+	// file with missing import is often incomplete, so partial AST is used
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if file == nil {
+		return "", "", errors.Wrap(err, "error on parse file")
+	}
+	tf := fset.File(file.Pos())
+	if offset < 0 || offset > tf.Size() {
+		return "", "", errors.Errorf("wrong offset: %d", offset)
+	}
+	pos := tf.Pos(offset)
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil || pos < n.Pos() || pos > n.End() {
+			return false
+		}
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				pkgName, symbol = x.Name, sel.Sel.Name
+			}
+		}
+		return pkgName == ""
+	})
+	if pkgName == "" {
+		return "", "", errors.Errorf("no selector at offset %d", offset)
+	}
+	return pkgName, symbol, nil
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSelectorAt(t *testing.T) {
+	src := []byte("package a\n\nfunc f() {\n\tvar wg sync.WaitGroup\n\tx.y.Z()\n}\n")
+	for _, tt := range []struct {
+		Offset      int
+		Pkg, Symbol string
+	}{
+		{30, "sync", "WaitGroup"},
+		{40, "sync", "WaitGroup"},
+		{46, "x", "y"},
+	} {
+		pkg, symbol, err := SelectorAt("a.go", src, tt.Offset)
+		if err != nil {
+			t.Fatalf("Error on selector at %d: %v", tt.Offset, err)
+		}
+		if pkg != tt.Pkg || symbol != tt.Symbol {
+			t.Errorf("Result: %s.%s", pkg, symbol)
+			t.Errorf("Expect: %s.%s", tt.Pkg, tt.Symbol)
+		}
+	}
+	if _, _, err := SelectorAt("a.go", src, 12); err == nil {
+		t.Errorf("Expect error on offset without selector")
+	}
+}
+
+func TestIndexResolve(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "golime_resolve")
+	if err != nil {
+		t.Fatalf("Error on create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	x := NewIndex(filepath.Join(tmpDir, "index.json"))
+	cc, err := x.Resolve(context.Background(), "./testdata/mod/a", "mod", "Mod")
+	if err != nil {
+		t.Fatalf("Error on resolve: %v", err)
+	}
+	expect := []ImportCandidate{{Path: "example.com/mod", Name: "mod", Score: matchSubsequence}}
+	if !reflect.DeepEqual(cc, expect) {
+		t.Errorf("Result: %v", cc)
+		t.Errorf("Expect: %v", expect)
+	}
+
+	// exports are cached
+	dir, err := filepath.Abs("./testdata/mod")
+	if err != nil {
+		t.Fatalf("Error on get abs path: %v", err)
+	}
+	if p := x.pkgs[dir]; p.Name != "mod" || !reflect.DeepEqual(p.Exports, []string{"Mod"}) {
+		t.Errorf("Wrong cached package: %v", p)
+	}
+
+	// name of package differs from its path
+	cc, err = x.Resolve(context.Background(), "./testdata/names", "api", "X")
+	if err != nil {
+		t.Fatalf("Error on resolve: %v", err)
+	}
+	if len(cc) != 1 || cc[0].Path != "example.com/names/x/client" {
+		t.Errorf("Wrong candidates of package named not by path: %v", cc)
+	}
+}
@@ -0,0 +1,7 @@
+package comments
+
+type Server struct{}
+
+func (s *Server) ListenAndServe() {}
+
+func RunAll() {}
@@ -0,0 +1,17 @@
+package impl
+
+import (
+	stdctx "context"
+	"io"
+)
+
+// File - file with stubs
+type File struct {
+	name string
+	io.Writer
+}
+
+// Close - it conflicts with io.Closer
+func (f *File) Close() {}
+
+func other(ctx stdctx.Context) {}
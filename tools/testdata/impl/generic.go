@@ -0,0 +1,31 @@
+package impl
+
+// Cache - generic storage of values by keys
+type Cache[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Put(key K, value V)
+	Keys() []K
+}
+
+// Number - constraint of numbers which can be printed
+type Number interface {
+	~int | ~int64
+	String() string
+}
+
+// Keyed - constraint of comparable values with keys
+type Keyed interface {
+	comparable
+	Key() string
+}
+
+// Users - cache of users
+type Users struct{}
+
+// Container - container of values of T
+type Container[T any] struct {
+	items []T
+}
+
+// Count - count of items
+type Count int
@@ -0,0 +1,7 @@
+package impl
+
+// Logged - store which logs calls
+type Logged struct {
+	Store
+	logs []string
+}
@@ -0,0 +1,18 @@
+package impl
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// Store - interface of storage
+type Store interface {
+	io.ReadWriteCloser
+	Get(ctx context.Context, key string) (*Item, error)
+	Set(items ...Item) error
+	Flush(*bytes.Buffer) error
+}
+
+// Item - item of Store
+type Item struct{}
@@ -0,0 +1,6 @@
+package a
+
+import "fmt"
+
+// A - value
+var A = fmt.Sprint("a")
@@ -0,0 +1,7 @@
+module example.com/mod
+
+go 1.18
+
+require example.com/dep v1.0.0
+
+replace example.com/dep => ./dep
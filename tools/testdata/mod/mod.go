@@ -0,0 +1,10 @@
+package mod
+
+import (
+	"fmt"
+
+	"example.com/mod/a"
+)
+
+// Mod - value
+var Mod = fmt.Sprint(a.A)
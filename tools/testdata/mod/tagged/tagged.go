@@ -0,0 +1,4 @@
+//go:build golime_never
+// +build golime_never
+
+package tagged
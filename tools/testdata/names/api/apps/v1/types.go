@@ -0,0 +1,4 @@
+package v1
+
+// Deployment - deployment
+type Deployment struct{}
@@ -0,0 +1,4 @@
+package v1
+
+// Pod - pod
+type Pod struct{}
@@ -0,0 +1,12 @@
+module example.com/names
+
+go 1.21
+
+require (
+	github.com/influxdata/influxdb1-client v0.0.0
+	k8s.io/api v0.0.0
+)
+
+replace github.com/influxdata/influxdb1-client => ./influx
+
+replace k8s.io/api => ./api
@@ -0,0 +1,3 @@
+module github.com/influxdata/influxdb1-client
+
+go 1.21
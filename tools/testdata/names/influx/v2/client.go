@@ -0,0 +1,4 @@
+package client
+
+// Client - client
+type Client interface{}
@@ -0,0 +1,4 @@
+package api
+
+// X - package name differs from last element of path
+var X int
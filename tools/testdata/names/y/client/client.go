@@ -0,0 +1,4 @@
+package client
+
+// Y - y
+var Y int
@@ -0,0 +1,47 @@
+package test
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("record is not found")
+
+var ErrClosedPipe error
+
+const MaxSize int = 10
+
+var Default = New()
+
+type Store interface {
+	io.Closer
+	Get(key string) ([]byte, error)
+}
+
+type Server struct {
+	Addr, Name string
+	store      Store
+}
+
+type Kind string
+
+func NewServer(addr string, s Store) *Server {
+	return &Server{Addr: addr, store: s}
+}
+
+func New() Server { return Server{} }
+
+func Newline() string { return "\n" }
+
+func (s *Server) Serve(w io.Writer) error { return nil }
+
+func Run() {}
+
+// Documented - is not changed
+func Documented() {}
+
+func unexported() {}
+
+type client struct{}
+
+func (c *client) Do() {}
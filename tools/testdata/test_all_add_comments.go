@@ -0,0 +1,38 @@
+package test
+
+import "io"
+
+var A, b = 1, 2
+
+const (
+	KindA = iota
+	KindB
+	kindC
+)
+
+// Documented group
+var (
+	X = 1
+	Y = 2
+)
+
+type Config struct {
+	Addr, Name string
+	Timeout    int // in seconds
+	io.Reader
+	// Documented field
+	Debug bool
+	hidden bool
+}
+
+type (
+	Store interface {
+		Get(key string) ([]byte, error)
+		Close()
+	}
+	Kind string
+)
+
+type unexported struct {
+	Field int
+}
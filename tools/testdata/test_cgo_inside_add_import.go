@@ -0,0 +1,8 @@
+package test
+
+import "fmt"
+
+// #include <stdlib.h>
+import "C"
+
+import "os"
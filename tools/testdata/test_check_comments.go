@@ -0,0 +1,51 @@
+package test
+
+// Good - is documented well
+func Good() {}
+
+// A Thing is allowed for types
+type Thing struct{}
+
+// OldName returns value
+func NewName() int { return 0 }
+
+// Returns the value
+func Value() int { return 0 }
+
+// returns the size
+func Size() int { return 0 }
+
+// Method is documented, but it is not shown
+func (t *thing) Method() {}
+
+// method - unexported method is not checked
+func (t *thing) method() {}
+
+type thing struct{}
+
+// Old - old function. Deprecated: use Good
+func Old() {}
+
+// Older - older function
+// deprecated use Good
+func Older() {}
+
+// Oldest - the oldest function
+//
+// DEPRECATED:use Good
+func Oldest() {}
+
+// Deprecated: use Thing
+type Legacy struct{}
+
+const (
+	// First constant
+	First = 1
+	// Second - second constant
+	Second = 2
+)
+
+// Fine - not deprecated function
+//
+// Deprecated: use Good
+func Fine() {}
@@ -0,0 +1,17 @@
+package test
+
+// #include <stdio.h>
+import "C"
+
+import (
+	// logging
+	"log" // std log
+
+	"github.com/pkg/errors" // wrapping
+	// end of block
+)
+
+// doc of os import
+import "os"
+
+func f() {}
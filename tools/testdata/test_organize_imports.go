@@ -0,0 +1,16 @@
+package test
+
+import (
+	"os"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/vkd/golime/tools"
+	_ "image/png"
+)
+
+import "bytes"
+
+func f() error {
+	fmt.Println(strings.ToUpper("a"))
+	return errors.Wrap(tools.ErrX, "")
+}